@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// maxAutocompleteChoices is the most choices Discord shows for an option.
+	maxAutocompleteChoices = 25
+
+	// autocompleteCandidates is how many entries are ranked for autocomplete, so the best completions aren't cut off.
+	autocompleteCandidates = 100
+
+	// autocompleteTimeout leaves time to answer within the 3 seconds Discord waits for completions.
+	autocompleteTimeout = 2 * time.Second
+)
+
+// exactCompletionBoost ranks words that are q itself above longer words starting with it, so they aren't crowded out of
+// the candidates.
+const exactCompletionBoost = 10
+
+// completionQuery matches entries whose word, simplified spelling or reading starts with q, or with a meaning that has
+// the words in q with the last one only started.
+func completionQuery(q string) query.Query {
+	var qs []query.Query
+	for _, field := range []string{"word_exact", "simplified_exact"} {
+		pq := bleve.NewPrefixQuery(q)
+		pq.SetField(field)
+		qs = append(qs, pq)
+
+		tq := bleve.NewTermQuery(q)
+		tq.SetField(field)
+		tq.SetBoost(exactCompletionBoost)
+		qs = append(qs, tq)
+	}
+
+	lower := strings.ToLower(q)
+	for _, field := range []string{"definitions.readings_exact", "definitions.readings_no_diacritics_exact"} {
+		rq := bleve.NewPrefixQuery(lower)
+		rq.SetField(field)
+		qs = append(qs, rq)
+	}
+
+	if terms := strings.Fields(lower); len(terms) > 0 {
+		var mqs []query.Query
+		for _, t := range terms[:len(terms)-1] {
+			tq := bleve.NewTermQuery(t)
+			tq.SetField("definitions.meanings_terms")
+			mqs = append(mqs, tq)
+		}
+
+		pq := bleve.NewPrefixQuery(terms[len(terms)-1])
+		pq.SetField("definitions.meanings_terms")
+		mqs = append(mqs, pq)
+
+		qs = append(qs, bleve.NewConjunctionQuery(mqs...))
+	}
+
+	return bleve.NewDisjunctionQuery(qs...)
+}
+
+// completionRank ranks how well r completes q: words first, then readings, then meanings, shortest first.
+func completionRank(r result, q string) (int, int) {
+	length := len([]rune(r.word))
+	if strings.HasPrefix(r.word, q) || containsPrefix(r.simplified, q) {
+		return 0, length
+	}
+	if lower := strings.ToLower(q); containsPrefix(r.readings, lower) || containsPrefix(r.readingsNoDiacritics, lower) {
+		return 1, length
+	}
+	return 2, length
+}
+
+func containsPrefix(ss []string, prefix string) bool {
+	for _, s := range ss {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// complete finds the words that q, as typed so far, could be looking up, in source if given.
+func (b *Bot) complete(ctx context.Context, q string, source string) ([]*discordgo.ApplicationCommandOptionChoice, error) {
+	idx, release := b.acquireIndex()
+	defer release()
+
+	var sourceMatch query.Query = bleve.NewMatchAllQuery()
+	if source != "" {
+		tq := bleve.NewTermQuery(source)
+		tq.SetField("source")
+		sourceMatch = tq
+	}
+
+	req := bleve.NewSearchRequest(bleve.NewConjunctionQuery(completionQuery(q), sourceMatch))
+	req.Size = autocompleteCandidates
+	req.Fields = []string{"word", "simplified", "definitions.readings", "definitions.readings_no_diacritics", "definitions.meanings"}
+
+	r, err := idx.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	type candidate struct {
+		result
+		meaning string
+		rank    int
+		length  int
+	}
+
+	candidates := make([]candidate, len(r.Hits))
+	for i, hit := range r.Hits {
+		c := candidate{result: result{
+			id:                   hit.ID,
+			word:                 hit.Fields["word"].(string),
+			simplified:           fieldToStringList(hit.Fields["simplified"]),
+			readings:             fieldToStringList(hit.Fields["definitions.readings"]),
+			readingsNoDiacritics: fieldToStringList(hit.Fields["definitions.readings_no_diacritics"]),
+		}}
+		if meanings := fieldToStringList(hit.Fields["definitions.meanings"]); len(meanings) > 0 {
+			c.meaning = meanings[0]
+		}
+		c.rank, c.length = completionRank(c.result, q)
+		candidates[i] = c
+	}
+
+	sort.SliceStable(candidates, func(i int, j int) bool {
+		if candidates[i].rank != candidates[j].rank {
+			return candidates[i].rank < candidates[j].rank
+		}
+		return candidates[i].length < candidates[j].length
+	})
+
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		label := c.word
+		if len(c.readings) > 0 {
+			label = fmt.Sprintf("%s (%s)", c.word, c.readings[0])
+		}
+		if c.meaning != "" {
+			label += ": " + c.meaning
+		}
+		label = truncate(label, 100, "...")
+
+		if seen[label] || len(c.word) > 100 {
+			continue
+		}
+		seen[label] = true
+
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: label, Value: c.word})
+		if len(choices) == maxAutocompleteChoices {
+			break
+		}
+	}
+
+	return choices, nil
+}
+
+// autocompleteResponse answers an autocomplete interaction. discordgo.InteractionResponseData leaves choices out when
+// there are none, but Discord needs them even then.
+type autocompleteResponse struct {
+	Type discordgo.InteractionResponseType `json:"type"`
+	Data struct {
+		Choices []*discordgo.ApplicationCommandOptionChoice `json:"choices"`
+	} `json:"data"`
+}
+
+// HandleAutocomplete suggests words for the query option of the commands that look words up.
+func (b *Bot) HandleAutocomplete(i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+
+	source := ""
+	if data.Name != "def" {
+		d, ok := b.dictionaryByCommand(data.Name)
+		if !ok {
+			log.Printf("Unknown command to autocomplete: %s", data.Name)
+			return
+		}
+		source = d.source
+	}
+
+	var q string
+	for _, option := range data.Options {
+		if option.Focused && option.Name == "query" {
+			q = strings.TrimSpace(option.StringValue())
+		}
+	}
+
+	// Discord needs an answer even if there's nothing to suggest, with empty rather than null choices. Advanced queries
+	// aren't words to complete.
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	if q != "" && !isAdvancedQuery(q) {
+		ctx, cancel := context.WithTimeout(context.Background(), autocompleteTimeout)
+		defer cancel()
+
+		completions, err := b.complete(ctx, q, source)
+		if err != nil {
+			log.Printf("Failed to complete %q: %s", q, err)
+		}
+		choices = append(choices, completions...)
+	}
+
+	resp := autocompleteResponse{Type: discordgo.InteractionApplicationCommandAutocompleteResult}
+	resp.Data.Choices = choices
+	if err := b.respond(i.Interaction, &resp); err != nil {
+		log.Printf("Failed to send completions: %s", err)
+		return
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// maxComponentCandidates bounds how many entries with every component are checked for a character that has them all.
+const maxComponentCandidates = 1000
+
+// parseComponents returns the components in q, e.g. 口 and 農 from "口農" or "口 農".
+func parseComponents(q string) []rune {
+	var components []rune
+	seen := make(map[rune]bool)
+	for _, r := range q {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || (r >= '⿰' && r <= '⿻') || seen[r] {
+			continue
+		}
+		seen[r] = true
+		components = append(components, r)
+	}
+	return components
+}
+
+// componentLookup finds entries whose word has a character made of every component in q.
+func (b *Bot) componentLookup(q string, source string, limit int, offset int) ([]result, uint64, error) {
+	components := parseComponents(q)
+	if len(components) == 0 {
+		return nil, 0, nil
+	}
+
+	idx, release := b.acquireIndex()
+	defer release()
+
+	qs := make([]query.Query, len(components))
+	for i, c := range components {
+		tq := bleve.NewTermQuery(string(c))
+		tq.SetField("components")
+		qs[i] = tq
+	}
+
+	// Every entry with a single component has a character with it, so there's nothing to check.
+	if len(components) == 1 {
+		return searchIndex(idx, qs[0], source, limit, offset)
+	}
+
+	candidates, _, err := searchIndex(idx, bleve.NewConjunctionQuery(qs...), source, maxComponentCandidates, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The components may be spread over several characters of the word, so check that one character has them all.
+	var results []result
+	for _, r := range candidates {
+		if hasComponentSet(r.componentSets, components) {
+			results = append(results, r)
+		}
+	}
+
+	count := uint64(len(results))
+	if offset >= len(results) {
+		return nil, count, nil
+	}
+	results = results[offset:]
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, count, nil
+}
+
+// hasComponentSet reports whether any of sets has every component.
+func hasComponentSet(sets []string, components []rune) bool {
+	for _, set := range sets {
+		all := true
+		for _, c := range components {
+			if !strings.ContainsRune(set, c) {
+				all = false
+				break
+			}
+		}
+
+		if all {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+
+	"github.com/GitTsubasa/gumby/manifest"
+)
+
+// Discord allows at most 100 guild commands, which leaves plenty of room next to /gumby and /def.
+const maxDictionaries = 50
+
+var invalidCommandChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+type dictionary struct {
+	source      string
+	command     string
+	description string
+	entries     uint64
+	manifest    manifest.Manifest
+}
+
+// attribution describes where a dictionary comes from, e.g. "Name · Author (1900) · License".
+func (d *dictionary) attribution() string {
+	parts := []string{d.manifest.Name}
+
+	if d.manifest.Author != "" && d.manifest.Year != 0 {
+		parts = append(parts, fmt.Sprintf("%s (%d)", d.manifest.Author, d.manifest.Year))
+	} else if d.manifest.Author != "" {
+		parts = append(parts, d.manifest.Author)
+	} else if d.manifest.Year != 0 {
+		parts = append(parts, fmt.Sprint(d.manifest.Year))
+	}
+
+	if d.manifest.License != "" {
+		parts = append(parts, d.manifest.License)
+	}
+
+	return strings.Join(parts, " · ")
+}
+
+// loadDictionaries finds every distinct source in the index, along with how many entries it has.
+func loadDictionaries(idx bleve.Index) ([]*dictionary, error) {
+	req := bleve.NewSearchRequest(bleve.NewMatchAllQuery())
+	req.Size = 0
+	req.AddFacet("source", bleve.NewFacetRequest("source", maxDictionaries))
+
+	r, err := idx.Search(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var dictionaries []*dictionary
+	for _, t := range r.Facets["source"].Terms {
+		d := &dictionary{
+			source:      t.Term,
+			command:     commandName(t.Term),
+			description: fmt.Sprintf("Look up in the %s dictionary", t.Term),
+			entries:     uint64(t.Count),
+			manifest:    manifest.Manifest{Name: t.Term},
+		}
+
+		rawManifest, err := idx.GetInternal([]byte(manifest.KeyPrefix + t.Term))
+		if err != nil {
+			return nil, err
+		}
+
+		// Indexes built before manifests existed fall back to names derived from the source.
+		if rawManifest != nil {
+			if err := json.Unmarshal(rawManifest, &d.manifest); err != nil {
+				return nil, fmt.Errorf("failed to parse manifest for %s: %w", t.Term, err)
+			}
+			d.command = d.manifest.Command
+			d.description = d.manifest.Description
+		}
+
+		dictionaries = append(dictionaries, d)
+	}
+
+	sort.Slice(dictionaries, func(i int, j int) bool {
+		return dictionaries[i].command < dictionaries[j].command
+	})
+
+	return dictionaries, nil
+}
+
+// commandName turns a source into a valid slash command name.
+func commandName(source string) string {
+	name := invalidCommandChars.ReplaceAllString(strings.ToLower(source), "_")
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return name
+}
+
+func (b *Bot) dictionaryByCommand(name string) (*dictionary, bool) {
+	for _, d := range b.dictionaries() {
+		if d.command == name {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+func (b *Bot) dictionaryBySource(source string) (*dictionary, bool) {
+	for _, d := range b.dictionaries() {
+		if d.source == source {
+			return d, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/bwmarrin/discordgo"
+)
+
+// allSourcesValue is the value of the option to search every dictionary again after narrowing down to one.
+const allSourcesValue = "*"
+
+// sourceCount is how many results a search has in a dictionary.
+type sourceCount struct {
+	source string
+	count  int
+}
+
+// canNarrow reports whether s searches every dictionary, so it can be narrowed down to one.
+func (s shdefActionGoToPage) canNarrow() bool {
+	return s.Mode == searchModeDefault && s.Source == ""
+}
+
+// sourceCounts counts the results of s in each dictionary, as if it hadn't been narrowed down to one, most first.
+func (b *Bot) sourceCounts(s shdefActionGoToPage) ([]sourceCount, error) {
+	idx, release := b.acquireIndex()
+	defer release()
+
+	textMatch, _, err := textMatchQuery(idx, strings.TrimSpace(s.Query))
+	if err != nil {
+		return nil, err
+	}
+
+	req := newSearchRequest(textMatch, s.Source, 0, 0)
+	req.Fields = nil
+	req.AddFacet("source", bleve.NewFacetRequest("source", maxDictionaries))
+
+	r, err := idx.Search(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var counts []sourceCount
+	for _, t := range r.Facets["source"].Terms {
+		counts = append(counts, sourceCount{source: t.Term, count: t.Count})
+	}
+
+	sort.SliceStable(counts, func(i int, j int) bool {
+		return counts[i].count > counts[j].count
+	})
+
+	return counts, nil
+}
+
+// dictionaryName returns the display name of the dictionary with source.
+func (b *Bot) dictionaryName(source string) string {
+	if d, ok := b.dictionaryBySource(source); ok {
+		return d.manifest.Name
+	}
+	return source
+}
+
+// describeSourceCounts breaks down the results of a search by dictionary, e.g. Dictionary 60 · Other 9.
+func (b *Bot) describeSourceCounts(counts []sourceCount) string {
+	parts := make([]string, len(counts))
+	for i, c := range counts {
+		parts[i] = fmt.Sprintf("%s %d", b.dictionaryName(c.source), c.count)
+	}
+	return strings.Join(parts, " · ")
+}
+
+// makeNarrowMenu makes a menu to narrow the search with token down to one dictionary, or to search every dictionary
+// again.
+func (b *Bot) makeNarrowMenu(s shdefActionGoToPage, counts []sourceCount, token string) discordgo.MessageComponent {
+	total := 0
+	for _, c := range counts {
+		total += c.count
+	}
+
+	options := []discordgo.SelectMenuOption{
+		{
+			Label:       "All dictionaries",
+			Description: pluralize(total, "result", "results"),
+			Value:       allSourcesValue,
+			Default:     s.Filter == "",
+		},
+	}
+	for _, c := range counts {
+		if len(options) == queryLimit {
+			break
+		}
+
+		options = append(options, discordgo.SelectMenuOption{
+			Label:       truncate(b.dictionaryName(c.source), 100, "..."),
+			Description: pluralize(c.count, "result", "results"),
+			Value:       c.source,
+			Default:     s.Filter == c.source,
+		})
+	}
+
+	return discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{
+				Placeholder: "Narrow down to a dictionary",
+				Options:     options,
+				CustomID:    customIDPrefixShdefNarrow + "|" + token,
+			},
+		},
+	}
+}
+
+// handleNarrow narrows a search down to the dictionary selected from its menu, or searches every dictionary again.
+func (b *Bot) handleNarrow(i *discordgo.InteractionCreate, rawPayload string) {
+	s, ok := b.loadSearch(i, rawPayload)
+	if !ok {
+		return
+	}
+
+	s.Filter = i.Interaction.MessageComponentData().Values[0]
+	if s.Filter == allSourcesValue {
+		s.Filter = ""
+	}
+	s.Page = 0
+	s.Romanization = parseRomanization(string(s.Romanization))
+
+	data, err := b.makeShdefResponse(s)
+	if err != nil {
+		log.Printf("Failed to find words: %s", err)
+		return
+	}
+
+	b.updateMessage(i, data)
+}
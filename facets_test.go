@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// findComponent returns the first component in rows with a custom ID starting with prefix.
+func findComponent(rows []discordgo.MessageComponent, prefix string) (discordgo.MessageComponent, bool) {
+	for _, row := range rows {
+		for _, c := range row.(discordgo.ActionsRow).Components {
+			switch c := c.(type) {
+			case discordgo.Button:
+				if strings.HasPrefix(c.CustomID, prefix+"|") {
+					return c, true
+				}
+			case discordgo.SelectMenu:
+				if strings.HasPrefix(c.CustomID, prefix+"|") {
+					return c, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// narrowMenuCounts returns the value of each option of the narrow menu in data, with its description and whether it's
+// chosen.
+func narrowMenuCounts(t *testing.T, data *discordgo.InteractionResponseData) (discordgo.SelectMenu, []string) {
+	t.Helper()
+
+	c, ok := findComponent(data.Components, customIDPrefixShdefNarrow)
+	if !ok {
+		t.Fatalf("got components %q, want a menu to narrow the search", customIDs(data.Components))
+	}
+	menu := c.(discordgo.SelectMenu)
+
+	var options []string
+	for _, o := range menu.Options {
+		option := o.Value + " " + o.Description
+		if o.Default {
+			option += " (chosen)"
+		}
+		options = append(options, option)
+	}
+	return menu, options
+}
+
+func TestNarrow(t *testing.T) {
+	b := newTwoDictionaryTestBot(t)
+
+	data, err := b.makeShdefResponse(shdefActionGoToPage{Query: "上海", Romanization: "church"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "_Shanghainese–English Dictionary 2 · Test Glossary 1_"; !strings.Contains(data.Content, want) {
+		t.Errorf("got content %q, want it to count %q", data.Content, want)
+	}
+
+	menu, options := narrowMenuCounts(t, data)
+	if want := []string{"* 3 results (chosen)", "dict 2 results", "glossary 1 result"}; !reflect.DeepEqual(options, want) {
+		t.Errorf("got narrow menu %q, want %q", options, want)
+	}
+
+	narrowed := handleComponent(t, b, data, menu.CustomID, "glossary")
+
+	_, options = narrowMenuCounts(t, narrowed)
+	if want := []string{"* 3 results", "dict 2 results", "glossary 1 result (chosen)"}; !reflect.DeepEqual(options, want) {
+		t.Errorf("got narrow menu %q after narrowing, want %q", options, want)
+	}
+
+	// The narrowed search is what the components of its message carry on with.
+	for _, customID := range customIDs(narrowed.Components) {
+		_, payload, _ := strings.Cut(customID, "|")
+		if strings.HasPrefix(customID, customIDPrefixShdefSelect+"|") {
+			_, payload, _ = strings.Cut(payload, "|")
+		}
+		token, _, _ := strings.Cut(payload, "|")
+
+		var s shdefActionGoToPage
+		if ok, err := b.sessions.load(token, &s); err != nil || !ok {
+			t.Fatalf("Failed to load the search of %s: %v", customID, err)
+		}
+		if s.Filter != "glossary" {
+			t.Errorf("%s carries filter %q, want %q", customID, s.Filter, "glossary")
+		}
+	}
+}
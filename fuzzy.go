@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/GitTsubasa/gumby/romanization"
+)
+
+// maxSuggestions is how many suggestions fit in a single row of buttons.
+const maxSuggestions = 5
+
+// suggestionCandidates is how many fuzzy matches are considered when making suggestions.
+const suggestionCandidates = 50
+
+type suggestion struct {
+	query string
+	label string
+}
+
+// fuzzyQuery matches every token of q within a small edit distance against readings and meanings.
+func fuzzyQuery(q string) query.Query {
+	var qs []query.Query
+	for _, field := range []string{"definitions.readings", "definitions.readings_no_diacritics", "definitions.meanings"} {
+		mq := bleve.NewMatchQuery(q)
+		mq.SetField(field)
+		mq.SetFuzziness(fuzziness(q))
+		mq.SetOperator(query.MatchQueryOperatorAnd)
+		qs = append(qs, mq)
+	}
+	return bleve.NewDisjunctionQuery(qs...)
+}
+
+// fuzziness allows one typo in short queries and two in longer ones.
+func fuzziness(q string) int {
+	if len([]rune(q)) > 6 {
+		return 2
+	}
+	return 1
+}
+
+// suggest finds readings and words close to q, for when q itself finds nothing.
+func (b *Bot) suggest(q string, source string) ([]suggestion, error) {
+	idx, release := b.acquireIndex()
+	defer release()
+
+	results, _, err := searchIndex(idx, fuzzyQuery(q), source, suggestionCandidates, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var suggestions []suggestion
+	seen := make(map[string]bool)
+	for _, r := range results {
+		s := closestSuggestion(r, q)
+		if seen[s.query] {
+			continue
+		}
+		seen[s.query] = true
+
+		suggestions = append(suggestions, s)
+		if len(suggestions) == maxSuggestions {
+			break
+		}
+	}
+
+	return suggestions, nil
+}
+
+// closestSuggestion suggests the reading of r closest to q, or the word itself if r only matched by meaning.
+func closestSuggestion(r result, q string) suggestion {
+	best, bestDistance := "", fuzziness(q)+1
+	for _, rd := range append(append([]string{}, r.readings...), r.readingsNoDiacritics...) {
+		for _, candidate := range append([]string{rd}, strings.Fields(rd)...) {
+			if d := editDistance(strings.ToLower(candidate), strings.ToLower(q)); d < bestDistance {
+				best, bestDistance = candidate, d
+			}
+		}
+	}
+
+	if best == "" {
+		return suggestion{query: r.word, label: r.word}
+	}
+
+	return suggestion{query: best, label: fmt.Sprintf("%s (%s)", best, r.word)}
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	ar, br := []rune(a), []rune(b)
+
+	prev := make([]int, len(br)+1)
+	cur := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		cur[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(br)]
+}
+
+func (b *Bot) makeSuggestionComponents(suggestions []suggestion, source string, system romanization.System) ([]discordgo.MessageComponent, error) {
+	if len(suggestions) == 0 {
+		return nil, nil
+	}
+
+	searches := make([]interface{}, len(suggestions))
+	for i, s := range suggestions {
+		searches[i] = shdefActionGoToPage{Query: s.query, Source: source, Romanization: system}
+	}
+
+	tokens, err := b.sessions.saveAll(searches...)
+	if err != nil {
+		return nil, err
+	}
+
+	var buttons []discordgo.MessageComponent
+	for i, s := range suggestions {
+		buttons = append(buttons, discordgo.Button{
+			Label:    truncate(s.label, 80, "..."),
+			Style:    discordgo.SecondaryButton,
+			CustomID: customIDPrefixShdefSearch + "|" + tokens[i],
+		})
+	}
+
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: buttons},
+	}, nil
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/GitTsubasa/gumby/romanization"
+)
+
+// maxGlossLength bounds how many characters of a sentence are glossed.
+const maxGlossLength = 200
+
+// lexicon maps every word and simplified spelling in the index to the entries with it, for segmenting sentences.
+type lexicon struct {
+	words map[string][]string
+
+	// maxLength is the length of the longest word, in runes.
+	maxLength int
+}
+
+// loadLexicon loads the word and simplified spellings of every entry, except phrase templates.
+func loadLexicon(idx bleve.Index) (*lexicon, error) {
+	count, err := idx.DocCount()
+	if err != nil {
+		return nil, err
+	}
+
+	req := bleve.NewSearchRequest(bleve.NewMatchAllQuery())
+	req.Size = int(count)
+	req.Fields = []string{"word", "simplified"}
+
+	r, err := idx.Search(req)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &lexicon{words: make(map[string][]string)}
+	add := func(w string, id string) {
+		if w == "" || strings.Contains(w, placeholder) {
+			return
+		}
+		for _, existing := range l.words[w] {
+			if existing == id {
+				return
+			}
+		}
+		l.words[w] = append(l.words[w], id)
+		l.maxLength = max(l.maxLength, len([]rune(w)))
+	}
+
+	// Add words before simplified spellings, so entries spelled the way the sentence is come first.
+	for _, field := range []string{"word", "simplified"} {
+		for _, hit := range r.Hits {
+			for _, w := range fieldToStringList(hit.Fields[field]) {
+				add(w, hit.ID)
+			}
+		}
+	}
+
+	return l, nil
+}
+
+// segment is a part of a sentence, with the entries it's a word of, if any.
+type segment struct {
+	text string
+	ids  []string
+}
+
+// segmentSentence splits s into words in the lexicon, leaving out as few characters as it can and then using as few
+// words as it can. Characters that aren't in any word are segments of their own, and whitespace is dropped.
+func (l *lexicon) segmentSentence(s string) []segment {
+	var segments []segment
+	for _, chunk := range strings.Fields(s) {
+		segments = append(segments, l.segmentChunk([]rune(chunk))...)
+	}
+	return segments
+}
+
+func (l *lexicon) segmentChunk(runes []rune) []segment {
+	type path struct {
+		unknown  int
+		segments int
+		next     int
+	}
+
+	// best[i] is the best way to segment runes[i:], found by working back from the end.
+	best := make([]path, len(runes)+1)
+	for i := len(runes) - 1; i >= 0; i-- {
+		best[i] = path{unknown: best[i+1].unknown + 1, segments: best[i+1].segments + 1, next: i + 1}
+
+		for j := i + 1; j <= len(runes) && j-i <= l.maxLength; j++ {
+			if _, ok := l.words[string(runes[i:j])]; !ok {
+				continue
+			}
+
+			// Between segmentations as good as each other, prefer the one with the longest first word.
+			p := path{unknown: best[j].unknown, segments: best[j].segments + 1, next: j}
+			if p.unknown < best[i].unknown || (p.unknown == best[i].unknown && p.segments <= best[i].segments) {
+				best[i] = p
+			}
+		}
+	}
+
+	var segments []segment
+	for i := 0; i < len(runes); i = best[i].next {
+		text := string(runes[i:best[i].next])
+		ids := l.words[text]
+
+		// Keep runs of letters and digits that aren't words together, e.g. abc.
+		if n := len(segments); n > 0 && ids == nil && segments[n-1].ids == nil && isAlphanumeric(runes[i]) && isAlphanumeric([]rune(segments[n-1].text)[0]) {
+			segments[n-1].text += text
+			continue
+		}
+
+		segments = append(segments, segment{text: text, ids: ids})
+	}
+
+	return segments
+}
+
+func isAlphanumeric(r rune) bool {
+	return (unicode.IsLetter(r) || unicode.IsDigit(r)) && !unicode.Is(unicode.Han, r)
+}
+
+// gloss segments sentence and finds the first entry of each word.
+func (b *Bot) gloss(sentence string) ([]segment, map[string]entry, error) {
+	idx, release := b.acquireIndex()
+	segments := idx.lexicon.segmentSentence(sentence)
+	release()
+
+	var ids []string
+	for _, s := range segments {
+		if len(s.ids) > 0 {
+			ids = append(ids, s.ids[0])
+		}
+	}
+
+	entries, err := b.findEntries(ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return segments, entries, nil
+}
+
+// firstGloss returns the first reading and meaning of e, or fallback if it has no reading.
+func firstGloss(e entry, fallback string, system romanization.System) (string, string) {
+	reading, meaning := fallback, "_Meaning unknown_"
+	if len(e.definitions) > 0 {
+		if len(e.definitions[0].readings) > 0 {
+			reading = romanization.Convert(e.definitions[0].readings[0], system)
+		}
+		if len(e.definitions[0].meanings) > 0 {
+			meaning = e.definitions[0].meanings[0]
+		}
+	}
+	return reading, meaning
+}
+
+// foundEntry returns the first entry of s, if it's a word.
+func foundEntry(s segment, entries map[string]entry) (entry, bool) {
+	if len(s.ids) == 0 {
+		return entry{}, false
+	}
+	e, ok := entries[s.ids[0]]
+	return e, ok
+}
+
+// makeWordsMenu makes a menu to look up each word in segments in full.
+func makeWordsMenu(segments []segment, entries map[string]entry, system romanization.System) []discordgo.MessageComponent {
+	var options []discordgo.SelectMenuOption
+	seen := make(map[string]bool)
+	for _, s := range segments {
+		e, ok := foundEntry(s, entries)
+		if !ok || seen[s.ids[0]] || len(options) == queryLimit {
+			continue
+		}
+		seen[s.ids[0]] = true
+
+		reading, meaning := firstGloss(e, s.text, system)
+		options = append(options, discordgo.SelectMenuOption{
+			Label:       truncate(fmt.Sprintf("%s (%s)", e.displayWord(), reading), 100, "..."),
+			Description: truncate(meaning, 100, "..."),
+			Value:       s.ids[0],
+		})
+	}
+
+	if len(options) == 0 {
+		return nil
+	}
+
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					Placeholder: "Select a word to look up",
+					Options:     options,
+					CustomID:    customIDPrefixShdefSelect + "|" + string(system),
+				},
+			},
+		},
+	}
+}
+
+// makeGlossOutput makes an interlinear gloss of segments, with the reading and first meaning of each word, and a menu
+// to look each word up in full.
+func makeGlossOutput(sentence string, segments []segment, entries map[string]entry, system romanization.System) *discordgo.InteractionResponseData {
+	var readingLine []string
+	var lines []string
+	for _, s := range segments {
+		e, ok := foundEntry(s, entries)
+		if !ok {
+			readingLine = append(readingLine, s.text)
+			if unicode.Is(unicode.Han, []rune(s.text)[0]) {
+				lines = append(lines, fmt.Sprintf("**%s** _not found_", s.text))
+			}
+			continue
+		}
+
+		reading, meaning := firstGloss(e, s.text, system)
+		readingLine = append(readingLine, reading)
+		lines = append(lines, fmt.Sprintf("**%s** %s: %s", s.text, reading, meaning))
+	}
+
+	content := fmt.Sprintf("**Gloss of “%s”**\n_%s_\n\n%s", sentence, strings.Join(readingLine, " "), strings.Join(lines, "\n"))
+	if system != romanization.Church {
+		content += "\n\n_Readings converted to " + system.Name() + "_"
+	}
+
+	return &discordgo.InteractionResponseData{
+		Content:    truncate(content, 2000, "..."),
+		Components: makeWordsMenu(segments, entries, system),
+	}
+}
+
+// HandleGloss glosses a sentence word by word.
+func (b *Bot) HandleGloss(i *discordgo.InteractionCreate) {
+	system := romanization.Church
+	var sentence string
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "sentence":
+			sentence = strings.TrimSpace(option.StringValue())
+		case "romanization":
+			system = parseRomanization(option.StringValue())
+		}
+	}
+
+	if runes := []rune(sentence); len(runes) > maxGlossLength {
+		sentence = string(runes[:maxGlossLength])
+	}
+
+	if sentence == "" {
+		b.respond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Embeds: []*discordgo.MessageEmbed{
+					{
+						Color:       0xDC2626,
+						Description: "You have to provide a sentence to gloss!",
+					},
+				},
+			},
+		})
+		return
+	}
+
+	segments, entries, err := b.gloss(sentence)
+	if err != nil {
+		b.respond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Embeds: []*discordgo.MessageEmbed{
+					{
+						Color:       0xDC2626,
+						Description: "An error occurred.",
+					},
+				},
+			},
+		})
+		log.Printf("Failed to gloss sentence: %s", err)
+		return
+	}
+
+	if err := b.respond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: makeGlossOutput(sentence, segments, entries, system),
+	}); err != nil {
+		log.Printf("Failed to send interaction: %s", err)
+		return
+	}
+}
+
+// lookUpMessageCommand is the name of the message command that looks up the words in a message.
+const lookUpMessageCommand = "Look up in Gumby"
+
+// maxMessageEmbedsLength is the most characters Discord allows in all the embeds of a message.
+const maxMessageEmbedsLength = 6000
+
+// maxMessageEmbeds is the most embeds Discord allows in a message.
+const maxMessageEmbeds = 10
+
+func embedLength(e *discordgo.MessageEmbed) int {
+	n := len(e.Title) + len(e.Description)
+	if e.Footer != nil {
+		n += len(e.Footer.Text)
+	}
+	return n
+}
+
+// fitEmbeds keeps as many of embeds as fit in a message, in order.
+func fitEmbeds(embeds []*discordgo.MessageEmbed) []*discordgo.MessageEmbed {
+	var fit []*discordgo.MessageEmbed
+	length := 0
+	for _, e := range embeds {
+		if len(fit) < maxMessageEmbeds && length+embedLength(e) <= maxMessageEmbedsLength {
+			fit = append(fit, e)
+			length += embedLength(e)
+		}
+	}
+	return fit
+}
+
+// HandleLookUpMessage privately replies with the words in a message, as many of their entries as fit, and a menu to
+// look up the rest.
+func (b *Bot) HandleLookUpMessage(i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+
+	var text string
+	if data.Resolved != nil {
+		if m, ok := data.Resolved.Messages[data.TargetID]; ok {
+			text = m.Content
+		}
+	}
+
+	reply := &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral}
+	if strings.TrimSpace(text) == "" {
+		reply.Content = "That message has no text to look up."
+	} else {
+		segments, entries, err := b.gloss(text)
+		if err != nil {
+			reply.Content = "An error occurred."
+			log.Printf("Failed to look up message: %s", err)
+		} else {
+			var words []string
+			var embeds []*discordgo.MessageEmbed
+			seen := make(map[string]bool)
+			for _, s := range segments {
+				e, ok := foundEntry(s, entries)
+				if !ok || seen[s.ids[0]] {
+					continue
+				}
+				seen[s.ids[0]] = true
+				words = append(words, s.text)
+
+				embeds = append(embeds, b.makeEntryOutput(e, romanization.Church))
+			}
+
+			if len(words) == 0 {
+				reply.Content = "No words found in that message."
+			} else {
+				reply.Content = truncate(fmt.Sprintf("**Words found:** %s", strings.Join(words, " · ")), 2000, "...")
+				reply.Embeds = fitEmbeds(embeds)
+				reply.Components = makeWordsMenu(segments, entries, romanization.Church)
+			}
+		}
+	}
+
+	if err := b.respond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: reply,
+	}); err != nil {
+		log.Printf("Failed to send interaction: %s", err)
+		return
+	}
+}
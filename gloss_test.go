@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testLexicon(words ...string) *lexicon {
+	l := &lexicon{words: make(map[string][]string)}
+	for _, w := range words {
+		l.words[w] = append(l.words[w], "dict:"+w)
+		l.maxLength = max(l.maxLength, len([]rune(w)))
+	}
+	return l
+}
+
+func TestSegmentSentence(t *testing.T) {
+	l := testLexicon("阿拉", "上海", "上海人", "海人", "人", "是", "儂", "好", "儂好")
+
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"", nil},
+		{"阿拉是上海人", []string{"阿拉", "是", "上海人"}},
+		// Fewer words win, so 上海人 isn't split into 上海 and 人.
+		{"上海人是", []string{"上海人", "是"}},
+		{"儂好", []string{"儂好"}},
+		{"儂 好", []string{"儂", "好"}},
+		// Characters that aren't in any word are left out as few times as possible.
+		{"阿拉歡喜上海", []string{"阿拉", "歡", "喜", "上海"}},
+		{"阿拉OK上海", []string{"阿拉", "OK", "上海"}},
+		{"儂好!", []string{"儂好", "!"}},
+		{"ab12 cd", []string{"ab12", "cd"}},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, s := range l.segmentSentence(tt.s) {
+			got = append(got, s.text)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("segmentSentence(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestSegmentChunkIDs(t *testing.T) {
+	l := testLexicon("上海", "人")
+	l.words["上海"] = append(l.words["上海"], "other:上海")
+
+	got := l.segmentChunk([]rune("上海x人"))
+	want := []segment{
+		{text: "上海", ids: []string{"dict:上海", "other:上海"}},
+		{text: "x"},
+		{text: "人", ids: []string{"dict:人"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("segmentChunk() = %+v, want %+v", got, want)
+	}
+}
@@ -8,6 +8,8 @@ require (
 	github.com/bwmarrin/discordgo v0.28.1
 	github.com/kelseyhightower/envconfig v1.4.0
 	github.com/liuzl/gocc v0.0.0-20231231122217-0372e1059ca5
+	github.com/mozillazg/go-pinyin v0.21.0
+	go.etcd.io/bbolt v1.3.5
 )
 
 require (
@@ -33,7 +35,6 @@ require (
 	github.com/liuzl/da v0.0.0-20180704015230-14771aad5b1d // indirect
 	github.com/mschoch/smat v0.2.0 // indirect
 	github.com/steveyen/gtreap v0.1.0 // indirect
-	go.etcd.io/bbolt v1.3.5 // indirect
 	golang.org/x/crypto v0.19.0 // indirect
 	golang.org/x/sys v0.17.0 // indirect
 )
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Discord gives up on an interaction if it isn't answered within 3 seconds.
+const interactionTimeout = 3 * time.Second
+
+const maxInteractionSize = 1 << 20
+
+var errInteractionExpired = errors.New("interaction expired before it was answered")
+
+type httpResponse struct {
+	resp    chan any
+	written chan struct{}
+	err     error
+}
+
+// respond answers an interaction, either through the pending HTTP request it arrived on or through the REST API. resp
+// is usually a *discordgo.InteractionResponse, but may be anything that encodes as one.
+func (b *Bot) respond(i *discordgo.Interaction, resp any) error {
+	v, ok := b.httpResponses.LoadAndDelete(i.ID)
+	if !ok {
+		if ir, ok := resp.(*discordgo.InteractionResponse); ok {
+			return b.discord.InteractionRespond(i, ir)
+		}
+
+		endpoint := discordgo.EndpointInteractionResponse(i.ID, i.Token)
+		_, err := b.discord.RequestWithBucketID(http.MethodPost, endpoint, resp, endpoint)
+		return err
+	}
+
+	hr := v.(*httpResponse)
+	hr.resp <- resp
+	<-hr.written
+	return hr.err
+}
+
+func (b *Bot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxInteractionSize)
+	if !discordgo.VerifyInteraction(r, b.publicKey) {
+		http.Error(w, "invalid request signature", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read request", http.StatusBadRequest)
+		return
+	}
+
+	var interaction discordgo.Interaction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		http.Error(w, "failed to parse interaction", http.StatusBadRequest)
+		return
+	}
+
+	if interaction.Type == discordgo.InteractionPing {
+		writeInteractionResponse(w, &discordgo.InteractionResponse{Type: discordgo.InteractionResponsePong})
+		return
+	}
+
+	hr := &httpResponse{
+		resp:    make(chan any, 1),
+		written: make(chan struct{}),
+	}
+	b.httpResponses.Store(interaction.ID, hr)
+	defer close(hr.written)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.handleInteraction(&discordgo.InteractionCreate{Interaction: &interaction})
+	}()
+
+	select {
+	case resp := <-hr.resp:
+		writeInteractionResponse(w, resp)
+
+	case <-done:
+		b.httpResponses.Delete(interaction.ID)
+		select {
+		case resp := <-hr.resp:
+			writeInteractionResponse(w, resp)
+		default:
+			log.Printf("Interaction %s was not answered", interaction.ID)
+			hr.err = errInteractionExpired
+			http.Error(w, "interaction was not answered", http.StatusInternalServerError)
+		}
+
+	case <-time.After(interactionTimeout):
+		b.httpResponses.Delete(interaction.ID)
+		log.Printf("Interaction %s timed out", interaction.ID)
+		hr.err = errInteractionExpired
+		http.Error(w, "interaction timed out", http.StatusServiceUnavailable)
+	}
+}
+
+func writeInteractionResponse(w http.ResponseWriter, resp any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to write interaction response: %s", err)
+		return
+	}
+
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
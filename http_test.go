@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// newHTTPTestBot returns a bot serving interactions over HTTP, signed with the returned key as Discord would.
+func newHTTPTestBot(t *testing.T) (*httptest.Server, ed25519.PrivateKey) {
+	t.Helper()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := openSessions("", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.store.Close() })
+
+	srv := httptest.NewServer(&Bot{publicKey: publicKey, sessions: s})
+	t.Cleanup(srv.Close)
+	return srv, privateKey
+}
+
+// postInteraction posts body to srv, signed with key if it isn't nil.
+func postInteraction(t *testing.T, srv *httptest.Server, key ed25519.PrivateKey, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key != nil {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Signature-Timestamp", timestamp)
+		req.Header.Set("X-Signature-Ed25519", hex.EncodeToString(ed25519.Sign(key, []byte(timestamp+body))))
+	}
+
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// handleComponent runs the handler of the component with customID, clicked on msg with values chosen, as if it had
+// arrived over HTTP, and returns what it answered with.
+func handleComponent(t *testing.T, b *Bot, msg *discordgo.InteractionResponseData, customID string, values ...string) *discordgo.InteractionResponseData {
+	t.Helper()
+
+	// Components of messages come from Discord as JSON, as pointers.
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m discordgo.Message
+	if err := json.Unmarshal(raw, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	i := &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		ID:      "1",
+		Type:    discordgo.InteractionMessageComponent,
+		Message: &m,
+		Data:    discordgo.MessageComponentInteractionData{CustomID: customID, Values: values},
+	}}
+
+	hr := &httpResponse{resp: make(chan any, 1), written: make(chan struct{})}
+	close(hr.written)
+	b.httpResponses.Store(i.ID, hr)
+	b.HandleComponentInteraction(i)
+
+	select {
+	case resp := <-hr.resp:
+		return resp.(*discordgo.InteractionResponse).Data
+	default:
+		t.Fatalf("%s was not answered", customID)
+		return nil
+	}
+}
+
+func decodeInteractionResponse(t *testing.T, resp *http.Response) discordgo.InteractionResponse {
+	t.Helper()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	var ir discordgo.InteractionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ir); err != nil {
+		t.Fatal(err)
+	}
+	return ir
+}
+
+func TestServeHTTPPing(t *testing.T) {
+	srv, key := newHTTPTestBot(t)
+
+	ir := decodeInteractionResponse(t, postInteraction(t, srv, key, `{"id":"1","type":1}`))
+	if ir.Type != discordgo.InteractionResponsePong {
+		t.Errorf("got response type %d, want %d", ir.Type, discordgo.InteractionResponsePong)
+	}
+}
+
+func TestServeHTTPSignature(t *testing.T) {
+	srv, _ := newHTTPTestBot(t)
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  ed25519.PrivateKey
+	}{
+		{"missing", nil},
+		{"wrong key", otherKey},
+	}
+
+	for _, tt := range tests {
+		resp := postInteraction(t, srv, tt.key, `{"id":"1","type":1}`)
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s signature: got status %d, want %d", tt.name, resp.StatusCode, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestServeHTTPCommand(t *testing.T) {
+	srv, key := newHTTPTestBot(t)
+
+	body := `{"id":"2","type":2,"token":"t","data":{"id":"3","name":"def","type":1,"options":[]}}`
+	ir := decodeInteractionResponse(t, postInteraction(t, srv, key, body))
+	if ir.Type != discordgo.InteractionResponseChannelMessageWithSource {
+		t.Fatalf("got response type %d, want %d", ir.Type, discordgo.InteractionResponseChannelMessageWithSource)
+	}
+	if len(ir.Data.Embeds) != 1 || !strings.Contains(ir.Data.Embeds[0].Description, "provide something to look up") {
+		t.Errorf("got %+v, want a message asking for a query", ir.Data)
+	}
+}
+
+func TestServeHTTPExpiredSearch(t *testing.T) {
+	srv, key := newHTTPTestBot(t)
+
+	body := `{"id":"4","type":3,"token":"t","message":{"id":"5"},"data":{"custom_id":"shdef:goToPage|AAAAAAAAAAAA|1","component_type":2}}`
+	ir := decodeInteractionResponse(t, postInteraction(t, srv, key, body))
+	if ir.Type != discordgo.InteractionResponseChannelMessageWithSource || ir.Data.Flags != discordgo.MessageFlagsEphemeral {
+		t.Errorf("got %+v, want an ephemeral message", ir)
+	}
+}
+
+func TestServeHTTPAutocompleteNothing(t *testing.T) {
+	srv, key := newHTTPTestBot(t)
+
+	body := `{"id":"6","type":4,"token":"t","data":{"id":"3","name":"def","type":1,"options":[{"name":"query","type":3,"value":"","focused":true}]}}`
+	resp := postInteraction(t, srv, key, body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), `"choices":[]`) {
+		t.Errorf("got %s, want empty choices", raw)
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+)
+
+// idsAnnotations are the source tags and markers some IDS databases add, e.g. ⿰亻農[GTJ].
+var idsAnnotations = regexp.MustCompile(`\[[^\]]*\]|[\^$]`)
+
+// idsDatabase maps characters to the Ideographic Description Sequences describing them.
+type idsDatabase struct {
+	sequences  map[rune][]string
+	components map[rune][]rune
+}
+
+var ids *idsDatabase
+
+// loadIDS reads an IDS database in the CHISE format: a code point, a character and its IDSes, separated by tabs.
+func loadIDS(path string) (*idsDatabase, error) {
+	db := &idsDatabase{sequences: map[rune][]string{}, components: map[rune][]rune{}}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		log.Printf("No IDS database at %s, only IDSes in words will be searchable by component", path)
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%s:%d: expected a code point, a character and an IDS", path, lineNum)
+		}
+
+		chars := []rune(fields[1])
+		if len(chars) != 1 {
+			return nil, fmt.Errorf("%s:%d: expected a single character, got %q", path, lineNum, fields[1])
+		}
+
+		// Characters described only by themselves are recorded without sequences, so they still count as described.
+		db.sequences[chars[0]] = db.sequences[chars[0]]
+
+		for _, seq := range fields[2:] {
+			seq = idsAnnotations.ReplaceAllString(seq, "")
+			if seq != "" && seq != fields[1] {
+				db.sequences[chars[0]] = append(db.sequences[chars[0]], seq)
+			}
+		}
+	}
+
+	return db, scanner.Err()
+}
+
+// componentsOf returns every component of r, decomposing components in turn, e.g. 儂 -> 亻農曲辰.
+func (db *idsDatabase) componentsOf(r rune) []rune {
+	if cs, ok := db.components[r]; ok {
+		return cs
+	}
+
+	// Guard against cycles while r is being decomposed.
+	db.components[r] = nil
+
+	var cs []rune
+	seen := map[rune]bool{r: true}
+	for _, seq := range db.sequences[r] {
+		for _, c := range seq {
+			if seen[c] || !isComponentRune(c) {
+				continue
+			}
+			seen[c] = true
+			cs = append(cs, c)
+
+			for _, cc := range db.componentsOf(c) {
+				if !seen[cc] {
+					seen[cc] = true
+					cs = append(cs, cc)
+				}
+			}
+		}
+	}
+
+	db.components[r] = cs
+	return cs
+}
+
+func isComponentRune(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Radical, r) || (r >= '㇀' && r <= '㇣')
+}
+
+// componentSets returns each character of word followed by its components. IDSes in the word count as a single
+// character, made of the characters in them.
+func (db *idsDatabase) componentSets(word string) []string {
+	var sets []string
+
+	runes := []rune(word)
+	for i := 0; i < len(runes); {
+		if isIDC(runes[i]) {
+			if end, ok := parseIDS(runes, i); ok {
+				var sb strings.Builder
+				sb.WriteString(string(runes[i:end]))
+				for _, r := range runes[i:end] {
+					if isComponentRune(r) {
+						sb.WriteString(string(db.componentsOf(r)))
+					}
+				}
+				sets = append(sets, sb.String())
+				i = end
+				continue
+			}
+		}
+
+		if isComponentRune(runes[i]) {
+			sets = append(sets, string(runes[i])+string(db.componentsOf(runes[i])))
+		}
+		i++
+	}
+
+	return sets
+}
+
+// addComponentFieldMappings adds the components of the characters of words, for /component. Each character's
+// components are also stored together, so the bot can check they're all in the same character.
+func addComponentFieldMappings(dm *mapping.DocumentMapping) {
+	components := bleve.NewTextFieldMapping()
+	components.Analyzer = "single_tokenize"
+	components.Store = false
+	components.IncludeInAll = false
+	dm.AddFieldMappingsAt("components", components)
+
+	sets := bleve.NewTextFieldMapping()
+	sets.Index = false
+	sets.IncludeInAll = false
+	dm.AddFieldMappingsAt("component_sets", sets)
+}
+
+// addComponents adds the components of the characters of word to doc.
+func addComponents(doc map[string]interface{}, word string) {
+	sets := ids.componentSets(word)
+	if len(sets) == 0 {
+		return
+	}
+
+	var components []string
+	seen := make(map[rune]bool)
+	for _, set := range sets {
+		for _, r := range set {
+			if !seen[r] && !isIDC(r) {
+				seen[r] = true
+				components = append(components, string(r))
+			}
+		}
+	}
+
+	doc["components"] = components
+	doc["component_sets"] = sets
+}
+
+// describes reports whether db has a line for r, even if r is described only by itself.
+func (db *idsDatabase) describes(r rune) bool {
+	_, ok := db.sequences[r]
+	return ok
+}
+
+// dictionaryCharacters finds every character that can have components in the words of the dictionaries in dir.
+func dictionaryCharacters(dir string) (map[rune]bool, error) {
+	inputs, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	chars := make(map[rune]bool)
+	for _, fi := range inputs {
+		if filepath.Ext(fi.Name()) != ".ndjson" {
+			continue
+		}
+
+		if err := func() error {
+			f, err := os.Open(filepath.Join(dir, fi.Name()))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			scanner := bufio.NewScanner(f)
+			scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+			for scanner.Scan() {
+				line := bytes.TrimSpace(scanner.Bytes())
+				if len(line) == 0 {
+					continue
+				}
+
+				// Invalid entries are left to lint.
+				var e struct {
+					Word string `json:"word"`
+				}
+				if json.Unmarshal(line, &e) != nil {
+					continue
+				}
+
+				word, _ := parseHomograph(e.Word)
+				for _, r := range word {
+					if isComponentRune(r) {
+						chars[r] = true
+					}
+				}
+			}
+			return scanner.Err()
+		}(); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", fi.Name(), err)
+		}
+	}
+
+	return chars, nil
+}
+
+// selectIDS returns the characters of db needed to decompose chars: those of chars it describes, and every component
+// they're described by in turn.
+func selectIDS(db *idsDatabase, chars map[rune]bool) []rune {
+	keep := make(map[rune]bool)
+
+	var visit func(r rune)
+	visit = func(r rune) {
+		if keep[r] || !db.describes(r) {
+			return
+		}
+		keep[r] = true
+
+		for _, seq := range db.sequences[r] {
+			for _, c := range seq {
+				if isComponentRune(c) {
+					visit(c)
+				}
+			}
+		}
+	}
+	for r := range chars {
+		visit(r)
+	}
+
+	selected := make([]rune, 0, len(keep))
+	for r := range keep {
+		selected = append(selected, r)
+	}
+	sort.Slice(selected, func(i int, j int) bool { return selected[i] < selected[j] })
+	return selected
+}
+
+const idsHeader = `# Ideographic Description Sequences, used to find characters by their components with /component.
+#
+# Each line is a code point, a character and one or more IDSes describing it, separated by tabs, in the same format as
+# the CHISE and cjkvi-ids databases (https://github.com/cjkvi/cjkvi-ids). Components are decomposed further using
+# their own lines, so 儂 is also found by 曲 and 辰. Lines starting with # are comments.
+#
+# Generated by importer ids from %s, keeping the characters in the dictionaries and the components
+# they're described by. Run it again after adding words with new characters.
+`
+
+// runGenerateIDS writes the lines of the IDS databases at paths needed to decompose the characters in the dictionaries
+// to the IDS database the importer reads, so the database bundled with them covers every character they use without
+// the rest of the full databases. It returns the exit code.
+func runGenerateIDS(paths []string) int {
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: importer ids <IDS database>...")
+		return 2
+	}
+
+	db := &idsDatabase{sequences: map[rune][]string{}, components: map[rune][]rune{}}
+	var names []string
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read IDS database: %s\n", err)
+			return 2
+		}
+
+		source, err := loadIDS(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read IDS database: %s\n", err)
+			return 2
+		}
+
+		// Databases split across files describe each character once, so the first description wins.
+		for r, seqs := range source.sequences {
+			if !db.describes(r) {
+				db.sequences[r] = seqs
+			}
+		}
+		names = append(names, filepath.Base(path))
+	}
+
+	chars, err := dictionaryCharacters(*inputPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read dictionaries: %s\n", err)
+		return 2
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, idsHeader, strings.Join(names, ", "))
+	for _, r := range selectIDS(db, chars) {
+		seqs := db.sequences[r]
+		if len(seqs) == 0 {
+			seqs = []string{string(r)}
+		}
+		fmt.Fprintf(&out, "U+%04X\t%c\t%s\n", r, r, strings.Join(seqs, "\t"))
+	}
+
+	if err := os.WriteFile(*idsPath, out.Bytes(), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write IDS database: %s\n", err)
+		return 2
+	}
+
+	missing := 0
+	for r := range chars {
+		if !db.describes(r) {
+			missing++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s; %d of %d characters in the dictionaries have no IDS\n", *idsPath, missing, len(chars))
+	return 0
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTestFile writes content to name in a temporary directory and returns its path.
+func writeTestFile(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testIDSDatabase(t *testing.T) *idsDatabase {
+	t.Helper()
+
+	path := writeTestFile(t, t.TempDir(), "ids.txt", strings.Join([]string{
+		"# comment",
+		"U+5102\t儂\t⿰亻農",
+		"U+8FB2\t農\t⿱曲辰[GTJ]",
+		"U+66F2\t曲\t曲",
+		"U+8FB0\t辰\t⿸厂⿱一⿰𠄌⿺乀丿",
+		"U+4EBB\t亻\t亻",
+		"U+4F60\t你\t⿰亻尔",
+		"",
+	}, "\n"))
+
+	db, err := loadIDS(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestLoadIDS(t *testing.T) {
+	db := testIDSDatabase(t)
+
+	if got, want := db.sequences['農'], []string{"⿱曲辰"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sequences[農] = %q, want %q", got, want)
+	}
+	if !db.describes('曲') || len(db.sequences['曲']) != 0 {
+		t.Errorf("曲 should be described with no sequences, got %q", db.sequences['曲'])
+	}
+	if db.describes('尔') {
+		t.Errorf("尔 has no line, but is described")
+	}
+}
+
+func TestSelectIDS(t *testing.T) {
+	db := testIDSDatabase(t)
+
+	tests := []struct {
+		chars string
+		want  string
+	}{
+		{"", ""},
+		{"曲", "曲"},
+		{"農", "曲辰農"},
+		{"儂", "亻儂曲辰農"},
+		{"你", "亻你"},
+		// Characters without a line are left out rather than invented.
+		{"尔好", ""},
+	}
+
+	for _, tt := range tests {
+		chars := make(map[rune]bool)
+		for _, r := range tt.chars {
+			chars[r] = true
+		}
+
+		if got := string(selectIDS(db, chars)); got != tt.want {
+			t.Errorf("selectIDS(%q) = %q, want %q", tt.chars, got, tt.want)
+		}
+	}
+}
+
+func TestDictionaryCharacters(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.ndjson", `{"word": "儂[1]", "definitions": []}
+{"word": "AA制", "definitions": []}
+not JSON
+`)
+	writeTestFile(t, dir, "b.ndjson", `{"word": "⿰亻尔", "definitions": []}`)
+	writeTestFile(t, dir, "notes.txt", `{"word": "曲", "definitions": []}`)
+
+	chars, err := dictionaryCharacters(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[rune]bool{'儂': true, '制': true, '亻': true, '尔': true}
+	if !reflect.DeepEqual(chars, want) {
+		t.Errorf("dictionaryCharacters() = %q, want %q", keys(chars), keys(want))
+	}
+}
+
+func keys(m map[rune]bool) []rune {
+	var rs []rune
+	for r := range m {
+		rs = append(rs, r)
+	}
+	return rs
+}
+
+func TestLintMissingIDS(t *testing.T) {
+	db := testIDSDatabase(t)
+
+	path := writeTestFile(t, t.TempDir(), "dict.ndjson", `{"word": "儂", "definitions": [{"readings": ["nong"], "meanings": ["you"]}]}
+{"word": "你好", "definitions": [{"readings": ["ni hau"], "meanings": ["hello"]}]}
+{"word": "好[1]", "definitions": [{"readings": ["hau"], "meanings": ["good"]}]}
+`)
+
+	ps, err := lintFile(path, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []int
+	for _, p := range ps {
+		if strings.Contains(p.Message, "no IDS") {
+			lines = append(lines, p.Line)
+		}
+	}
+	// 好 is reported once, at the first word with it.
+	if want := []int{2}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("got warnings about missing IDSes on lines %v, want %v (problems: %+v)", lines, want, ps)
+	}
+
+	ps, err = lintFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range ps {
+		if strings.Contains(p.Message, "no IDS") {
+			t.Errorf("got %q without an IDS database", p.Message)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+)
+
+// importStateKey is the internal index key the state of the last import is stored under.
+const importStateKey = "import_state"
+
+// importState records what was indexed, so the next incremental import only has to touch what changed.
+type importState struct {
+	// MappingHash identifies the index mapping the index was built with. Indexes built with another mapping have to
+	// be rebuilt from scratch.
+	MappingHash string `json:"mapping_hash"`
+
+	// Hashes holds the hash of every indexed document, by document ID.
+	Hashes map[string]string `json:"hashes"`
+}
+
+func newImportState(mappingHash string) *importState {
+	return &importState{MappingHash: mappingHash, Hashes: make(map[string]string)}
+}
+
+func loadImportState(idx bleve.Index) (*importState, error) {
+	raw, err := idx.GetInternal([]byte(importStateKey))
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	var s importState
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (s *importState) save(idx bleve.Index) error {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return idx.SetInternal([]byte(importStateKey), raw)
+}
+
+// sources returns every source that has documents in the state.
+func (s *importState) sources() map[string]bool {
+	sources := make(map[string]bool)
+	for id := range s.Hashes {
+		sources[id[:strings.IndexRune(id, ':')]] = true
+	}
+	return sources
+}
+
+// removedIDs returns the IDs of the documents in s that aren't in next, in order.
+func (s *importState) removedIDs(next *importState) []string {
+	var ids []string
+	for id := range s.Hashes {
+		if _, ok := next.Hashes[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func hashJSON(v interface{}) (string, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func hashMapping(m mapping.IndexMapping) (string, error) {
+	return hashJSON(m)
+}
+
+// openIncremental copies the current version of the index into versionPath and opens it, along with the state of the
+// import that built it. It returns a nil index if there is nothing that can be updated incrementally.
+func openIncremental(root string, versionPath string, mappingHash string) (bleve.Index, *importState, error) {
+	current, ok := currentVersionPath(root)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	if err := copyDir(current, versionPath); err != nil {
+		return nil, nil, err
+	}
+
+	idx, err := bleve.Open(versionPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	prev, err := loadImportState(idx)
+	if err != nil || prev == nil || prev.MappingHash != mappingHash {
+		idx.Close()
+		os.RemoveAll(versionPath)
+		return nil, nil, err
+	}
+
+	return idx, prev, nil
+}
+
+func copyDir(src string, dst string) error {
+	return filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if fi.IsDir() {
+			return os.MkdirAll(target, fi.Mode().Perm())
+		}
+
+		return copyFile(path, target, fi.Mode().Perm())
+	})
+}
+
+func copyFile(src string, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/liuzl/gocc"
+)
+
+func TestHashJSON(t *testing.T) {
+	a, err := hashJSON(map[string]interface{}{"word": "儂", "source": "dict"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys are hashed in order, however the map was built.
+	b, _ := hashJSON(map[string]interface{}{"source": "dict", "word": "儂"})
+	if a != b {
+		t.Errorf("hashes of equal documents differ: %s, %s", a, b)
+	}
+
+	c, _ := hashJSON(map[string]interface{}{"word": "農", "source": "dict"})
+	if a == c {
+		t.Errorf("hashes of different documents are both %s", a)
+	}
+}
+
+func TestRemovedIDs(t *testing.T) {
+	prev := &importState{Hashes: map[string]string{"dict:b": "1", "dict:a": "2", "other:a": "3"}}
+	next := &importState{Hashes: map[string]string{"dict:a": "4", "dict:c": "5"}}
+
+	if got, want := prev.removedIDs(next), []string{"dict:b", "other:a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("removedIDs() = %q, want %q", got, want)
+	}
+	if got := next.removedIDs(next); got != nil {
+		t.Errorf("removedIDs() of the same state = %q, want none", got)
+	}
+	if got, want := prev.sources(), map[string]bool{"dict": true, "other": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sources() = %v, want %v", got, want)
+	}
+}
+
+func TestImportFileIncremental(t *testing.T) {
+	var err error
+	if t2s, err = gocc.New("t2s"); err != nil {
+		t.Fatal(err)
+	}
+	ids = &idsDatabase{sequences: map[rune][]string{}, components: map[rune][]rune{}}
+
+	m, err := buildIndexMapping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := bleve.NewMemOnly(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	dir := t.TempDir()
+	entries := `{"word": "儂", "definitions": [{"readings": ["nong"], "meanings": ["you"]}]}
+{"word": "阿拉", "definitions": [{"readings": ["ah la"], "meanings": ["we"]}]}
+`
+	path := writeTestFile(t, dir, "dict.ndjson", entries)
+
+	tests := []struct {
+		name    string
+		entries string
+		changed int
+		removed []string
+	}{
+		{"first import", entries, 2, nil},
+		{"nothing changed", entries, 0, nil},
+		{"meaning changed", `{"word": "儂", "definitions": [{"readings": ["nong"], "meanings": ["you (singular)"]}]}
+{"word": "阿拉", "definitions": [{"readings": ["ah la"], "meanings": ["we"]}]}
+`, 1, nil},
+		{"entry removed", `{"word": "阿拉", "definitions": [{"readings": ["ah la"], "meanings": ["we"]}]}
+`, 0, []string{"dict:儂"}},
+	}
+
+	var prev *importState
+	for _, tt := range tests {
+		writeTestFile(t, dir, "dict.ndjson", tt.entries)
+
+		next := newImportState("mapping")
+		_, changed, err := importFile(idx, path, prev, next)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if changed != tt.changed {
+			t.Errorf("%s: indexed %d changed entries, want %d", tt.name, changed, tt.changed)
+		}
+
+		if prev != nil {
+			if got := prev.removedIDs(next); !reflect.DeepEqual(got, tt.removed) {
+				t.Errorf("%s: removed %q, want %q", tt.name, got, tt.removed)
+			}
+		}
+		prev = next
+	}
+}
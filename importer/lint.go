@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/GitTsubasa/gumby/manifest"
+)
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// maxLineSize is the longest entry we'll read from a dictionary file.
+const maxLineSize = 16 << 20
+
+const (
+	unrepresentableChar     = '□'
+	placeholderChar         = '…'
+	sayingSeparatorChar     = '-'
+	readingPlaceholderChars = "…_"
+)
+
+var (
+	homographSuffix        = regexp.MustCompile(`\[([1-9][0-9]*)\]$`)
+	spacedHomographSuffix  = regexp.MustCompile(`\s+\[[0-9]+\]$`)
+	parenHomographSuffix   = regexp.MustCompile(`\([0-9]+\)$`)
+	zeroPadHomographSuffix = regexp.MustCompile(`\[0[0-9]*\]$`)
+)
+
+var (
+	allowedEntryKeys      = map[string]bool{"word": true, "definitions": true}
+	allowedDefinitionKeys = map[string]bool{"readings": true, "meanings": true}
+)
+
+type lintProblem struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+type lintProblems []lintProblem
+
+func (ps *lintProblems) add(severity string, format string, args ...interface{}) {
+	*ps = append(*ps, lintProblem{Severity: severity, Message: fmt.Sprintf(format, args...)})
+}
+
+func (ps lintProblems) firstError() *lintProblem {
+	for i := range ps {
+		if ps[i].Severity == severityError {
+			return &ps[i]
+		}
+	}
+	return nil
+}
+
+// lintEntry checks a single line of a dictionary against the Entry schema in dictionaries/README.md.
+func lintEntry(line []byte) lintProblems {
+	var ps lintProblems
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(line, &raw); err != nil {
+		ps.add(severityError, "invalid JSON object: %s", err)
+		return ps
+	}
+
+	for k := range raw {
+		if !allowedEntryKeys[k] {
+			ps.add(severityError, "unknown key %q", k)
+		}
+	}
+
+	var word string
+	if rawWord, ok := raw["word"]; !ok {
+		ps.add(severityError, "missing key \"word\"")
+	} else if err := json.Unmarshal(rawWord, &word); err != nil {
+		ps.add(severityError, "\"word\" must be a string")
+	} else {
+		lintWord(&ps, word)
+	}
+
+	var definitions []map[string]json.RawMessage
+	if rawDefinitions, ok := raw["definitions"]; !ok {
+		ps.add(severityError, "missing key \"definitions\"")
+		return ps
+	} else if err := json.Unmarshal(rawDefinitions, &definitions); err != nil {
+		ps.add(severityError, "\"definitions\" must be an array of objects")
+		return ps
+	}
+
+	if len(definitions) == 0 {
+		ps.add(severityError, "\"definitions\" is empty")
+	}
+
+	placeholders := strings.Count(word, string(placeholderChar))
+
+	for i, def := range definitions {
+		if def == nil {
+			ps.add(severityError, "definitions[%d] must be an object", i)
+			continue
+		}
+
+		for k := range def {
+			if !allowedDefinitionKeys[k] {
+				ps.add(severityError, "definitions[%d]: unknown key %q", i, k)
+			}
+		}
+
+		readings, ok := lintStringList(&ps, def, i, "readings")
+		if ok {
+			if len(readings) == 0 {
+				ps.add(severityWarning, "definitions[%d]: no readings", i)
+			}
+
+			for j, reading := range readings {
+				if strings.TrimSpace(reading) == "" {
+					ps.add(severityWarning, "definitions[%d].readings[%d] is empty", i, j)
+					continue
+				}
+
+				n := 0
+				for _, r := range reading {
+					if strings.ContainsRune(readingPlaceholderChars, r) {
+						n++
+					}
+				}
+				if n != placeholders {
+					ps.add(severityWarning, "definitions[%d].readings[%d]: %d placeholders, but word has %d", i, j, n, placeholders)
+				}
+			}
+		}
+
+		meanings, ok := lintStringList(&ps, def, i, "meanings")
+		if ok {
+			if len(meanings) == 0 {
+				ps.add(severityWarning, "definitions[%d]: no meanings", i)
+			}
+
+			for j, meaning := range meanings {
+				if strings.TrimSpace(meaning) == "" {
+					ps.add(severityWarning, "definitions[%d].meanings[%d] is empty", i, j)
+				}
+			}
+		}
+	}
+
+	return ps
+}
+
+func lintStringList(ps *lintProblems, def map[string]json.RawMessage, i int, key string) ([]string, bool) {
+	raw, ok := def[key]
+	if !ok {
+		ps.add(severityError, "definitions[%d]: missing key %q", i, key)
+		return nil, false
+	}
+
+	var out []string
+	if err := json.Unmarshal(raw, &out); err != nil || out == nil {
+		ps.add(severityError, "definitions[%d].%s must be an array of strings", i, key)
+		return nil, false
+	}
+
+	return out, true
+}
+
+func lintWord(ps *lintProblems, word string) {
+	if strings.TrimSpace(word) == "" {
+		ps.add(severityError, "\"word\" is empty")
+		return
+	}
+
+	if word != strings.TrimSpace(word) {
+		ps.add(severityWarning, "word %q has leading or trailing whitespace", word)
+	}
+
+	switch {
+	case spacedHomographSuffix.MatchString(word):
+		ps.add(severityWarning, "word %q has whitespace before its homograph suffix", word)
+	case parenHomographSuffix.MatchString(word):
+		ps.add(severityWarning, "word %q has a homograph suffix that should be written [n]", word)
+	case zeroPadHomographSuffix.MatchString(word):
+		ps.add(severityWarning, "word %q has a homograph suffix that should start from [1]", word)
+	}
+
+	runes := []rune(homographSuffix.ReplaceAllString(strings.TrimSpace(word), ""))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		if isIDC(r) {
+			next, ok := parseIDS(runes, i)
+			if !ok {
+				ps.add(severityWarning, "word %q has an incomplete ideographic description sequence", word)
+				return
+			}
+			i = next - 1
+			continue
+		}
+
+		if !isAllowedWordRune(r) {
+			ps.add(severityWarning, "word %q has unexpected character %q (U+%04X)", word, r, r)
+		}
+	}
+}
+
+func isAllowedWordRune(r rune) bool {
+	return unicode.Is(unicode.Ideographic, r) ||
+		r == unrepresentableChar ||
+		r == placeholderChar ||
+		r == sayingSeparatorChar ||
+		// Loanwords such as AA制 and K歌 are written with Latin letters and digits.
+		(r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)))
+}
+
+// isIDC reports whether r is one of the ideographic description characters ⿰⿱⿲⿳⿴⿵⿶⿷⿸⿹⿺⿻.
+func isIDC(r rune) bool {
+	return r >= '⿰' && r <= '⿻'
+}
+
+// parseIDS parses the ideographic description sequence starting at runes[i], returning the index just past it.
+func parseIDS(runes []rune, i int) (int, bool) {
+	if i >= len(runes) {
+		return i, false
+	}
+
+	r := runes[i]
+	if !isIDC(r) {
+		return i + 1, unicode.Is(unicode.Ideographic, r) ||
+			unicode.Is(unicode.Radical, r) ||
+			(r >= '㇀' && r <= '㇣') ||
+			r == unrepresentableChar
+	}
+
+	arity := 2
+	if r == '⿲' || r == '⿳' {
+		arity = 3
+	}
+
+	i++
+	for k := 0; k < arity; k++ {
+		var ok bool
+		if i, ok = parseIDS(runes, i); !ok {
+			return i, false
+		}
+	}
+
+	return i, true
+}
+
+// lintFile reports every problem in a dictionary and its manifest. If db isn't nil, it also reports the first word with
+// each character db has no IDS for.
+func lintFile(path string, db *idsDatabase) (lintProblems, error) {
+	var ps lintProblems
+
+	if _, err := manifest.Load(manifest.Path(path)); err != nil {
+		ps = append(ps, lintProblem{File: manifest.Path(path), Severity: severityError, Message: err.Error()})
+	}
+
+	input, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	seen := make(map[string]int)
+	undescribed := make(map[rune]bool)
+
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		for _, p := range lintEntry(line) {
+			p.File = path
+			p.Line = lineno
+			ps = append(ps, p)
+		}
+
+		var e struct {
+			Word string `json:"word"`
+		}
+		if json.Unmarshal(line, &e) != nil {
+			continue
+		}
+
+		if db != nil {
+			word, _ := parseHomograph(e.Word)
+			for _, r := range word {
+				if unicode.Is(unicode.Han, r) && !db.describes(r) && !undescribed[r] {
+					undescribed[r] = true
+					ps = append(ps, lintProblem{
+						File:     path,
+						Line:     lineno,
+						Severity: severityWarning,
+						Message:  fmt.Sprintf("character %q (U+%04X) in word %q has no IDS, so /component can't find it by its components", r, r, e.Word),
+					})
+				}
+			}
+		}
+
+		if first, ok := seen[e.Word]; ok {
+			ps = append(ps, lintProblem{
+				File:     path,
+				Line:     lineno,
+				Severity: severityWarning,
+				Message:  fmt.Sprintf("word %q already appears on line %d", e.Word, first),
+			})
+			continue
+		}
+		seen[e.Word] = lineno
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return ps, nil
+}
+
+// runLint lints the given dictionaries, or every dictionary in the input path, and writes the problems as NDJSON to
+// stdout. It returns the exit code.
+func runLint(paths []string) int {
+	if len(paths) == 0 {
+		inputs, err := os.ReadDir(*inputPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to list inputs: %s\n", err)
+			return 2
+		}
+
+		for _, fi := range inputs {
+			if filepath.Ext(fi.Name()) == ".ndjson" {
+				paths = append(paths, filepath.Join(*inputPath, fi.Name()))
+			}
+		}
+	}
+
+	// Without an IDS database, no character has one, so there's nothing to report.
+	db, err := loadIDS(*idsPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load IDS database: %s\n", err)
+		return 2
+	}
+	if len(db.sequences) == 0 {
+		db = nil
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+
+	errors, warnings := 0, 0
+	for _, path := range paths {
+		ps, err := lintFile(path, db)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to lint %s: %s\n", path, err)
+			return 2
+		}
+
+		for _, p := range ps {
+			if p.Severity == severityError {
+				errors++
+			} else {
+				warnings++
+			}
+			enc.Encode(p)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d errors, %d warnings in %d files\n", errors, warnings, len(paths))
+
+	if errors > 0 {
+		return 1
+	}
+	return 0
+}
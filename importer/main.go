@@ -1,14 +1,18 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/blevesearch/bleve/v2"
 	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
@@ -19,14 +23,25 @@ import (
 	"github.com/blevesearch/bleve/v2/analysis/tokenizer/whitespace"
 	"github.com/blevesearch/bleve/v2/mapping"
 	"github.com/liuzl/gocc"
+
+	"github.com/GitTsubasa/gumby/manifest"
+	"github.com/GitTsubasa/gumby/romanization"
 )
 
 var (
-	indexPath     = flag.String("index_path", "dict.bleve", "Path to index.")
+	indexPath     = flag.String("index_path", "dict.bleve", "Path to the directory holding versions of the index.")
+	incremental   = flag.Bool("incremental", false, "Only reindex entries that changed since the last import?")
+	onDuplicate   = flag.String("on_duplicate", "merge", "What to do with words that occur more than once in a dictionary: merge their definitions, or fail.")
+	keepVersions  = flag.Int("keep_versions", 2, "Number of versions of the index to keep, including the current one. At least 2.")
 	inputPath     = flag.String("input_path", "../dictionaries", "Path to input.")
+	idsPath       = flag.String("ids_path", "../dictionaries/ids.txt", "Path to the database of Ideographic Description Sequences, for searching by component.")
+	unihanPath    = flag.String("unihan_path", "../dictionaries/unihan.txt", "Path to Unihan radical-stroke counts, for browsing by radical.")
 	writeToStdout = flag.Bool("write_to_stdout", false, "Write augmented entries to stdout?")
 )
 
+// homographSuffixPattern also accepts whitespace before the suffix, which lint warns about.
+var homographSuffixPattern = regexp.MustCompile(`\s*\[([1-9][0-9]*)\]$`)
+
 var diacriticsReplacer = strings.NewReplacer(
 	"á", "aa",
 	"ó", "o",
@@ -37,6 +52,17 @@ var diacriticsReplacer = strings.NewReplacer(
 	"'", "h",
 )
 
+// exactFieldMapping indexes a whole field value as a single term, for wildcard and prefix matching.
+func exactFieldMapping(name string) *mapping.FieldMapping {
+	fm := bleve.NewTextFieldMapping()
+	fm.Name = name
+	fm.Analyzer = "single_tokenize"
+	fm.Store = false
+	fm.IncludeInAll = false
+	fm.IncludeTermVectors = false
+	return fm
+}
+
 func buildIndexMapping() (mapping.IndexMapping, error) {
 	indexMapping := bleve.NewIndexMapping()
 
@@ -84,16 +110,43 @@ func buildIndexMapping() (mapping.IndexMapping, error) {
 		return nil, err
 	}
 
+	if err := indexMapping.AddCustomAnalyzer("lowercase_tokenize",
+		map[string]interface{}{
+			"type":          custom.Name,
+			"char_filters":  []interface{}{},
+			"tokenizer":     unicode.Name,
+			"token_filters": []interface{}{lowercase.Name},
+		}); err != nil {
+		return nil, err
+	}
+
 	entryDocumentMapping := bleve.NewDocumentMapping()
 	{
 		wordFieldMapping := bleve.NewTextFieldMapping()
 		wordFieldMapping.Analyzer = "unicode_tokenize"
-		entryDocumentMapping.AddFieldMappingsAt("word", wordFieldMapping)
+		entryDocumentMapping.AddFieldMappingsAt("word", wordFieldMapping, exactFieldMapping("word_exact"))
 
 		simplifiedMapping := bleve.NewTextFieldMapping()
 		simplifiedMapping.Analyzer = "unicode_tokenize"
 		simplifiedMapping.IncludeInAll = false
-		entryDocumentMapping.AddFieldMappingsAt("simplified", simplifiedMapping)
+		entryDocumentMapping.AddFieldMappingsAt("simplified", simplifiedMapping, exactFieldMapping("simplified_exact"))
+
+		addPinyinFieldMappings(entryDocumentMapping)
+		addComponentFieldMappings(entryDocumentMapping)
+		addRadicalFieldMappings(entryDocumentMapping)
+
+		isTemplateMapping := bleve.NewBooleanFieldMapping()
+		isTemplateMapping.IncludeInAll = false
+		entryDocumentMapping.AddFieldMappingsAt("is_template", isTemplateMapping)
+
+		homographMapping := bleve.NewNumericFieldMapping()
+		homographMapping.IncludeInAll = false
+		entryDocumentMapping.AddFieldMappingsAt("homograph", homographMapping)
+
+		// The bot ranks shorter words first among equally relevant results.
+		wordLengthMapping := bleve.NewNumericFieldMapping()
+		wordLengthMapping.IncludeInAll = false
+		entryDocumentMapping.AddFieldMappingsAt("word_length", wordLengthMapping)
 
 		source := bleve.NewTextFieldMapping()
 		source.Analyzer = "single_tokenize"
@@ -104,16 +157,36 @@ func buildIndexMapping() (mapping.IndexMapping, error) {
 		{
 			meaningsMapping := bleve.NewTextFieldMapping()
 			meaningsMapping.Analyzer = "en_nostop"
-			definitionDocumentMapping.AddFieldMappingsAt("meanings", meaningsMapping)
+
+			// Meanings are also indexed unstemmed, so the bot can complete words in them as they're typed.
+			meaningsTerms := bleve.NewTextFieldMapping()
+			meaningsTerms.Name = "meanings_terms"
+			meaningsTerms.Analyzer = "lowercase_tokenize"
+			meaningsTerms.Store = false
+			meaningsTerms.IncludeInAll = false
+			meaningsTerms.IncludeTermVectors = false
+			definitionDocumentMapping.AddFieldMappingsAt("meanings", meaningsMapping, meaningsTerms)
+
+			// Each sense of the meanings, so the bot can rank meanings that are the query above meanings mentioning it.
+			definitionDocumentMapping.AddFieldMappingsAt("senses", exactFieldMapping("senses"))
 
 			readingsMapping := bleve.NewTextFieldMapping()
 			readingsMapping.Analyzer = "whitespace_tokenize"
-			definitionDocumentMapping.AddFieldMappingsAt("readings", readingsMapping)
+			definitionDocumentMapping.AddFieldMappingsAt("readings", readingsMapping, exactFieldMapping("readings_exact"))
 
 			readingsNoDiacritics := bleve.NewTextFieldMapping()
 			readingsNoDiacritics.IncludeInAll = false
 			readingsNoDiacritics.Analyzer = "whitespace_tokenize"
-			definitionDocumentMapping.AddFieldMappingsAt("readings_no_diacritics", readingsNoDiacritics)
+			definitionDocumentMapping.AddFieldMappingsAt("readings_no_diacritics", readingsNoDiacritics, exactFieldMapping("readings_no_diacritics_exact"))
+
+			for _, system := range romanization.Converted {
+				field := "readings_" + string(system)
+
+				readingsConverted := bleve.NewTextFieldMapping()
+				readingsConverted.IncludeInAll = false
+				readingsConverted.Analyzer = "whitespace_tokenize"
+				definitionDocumentMapping.AddFieldMappingsAt(field, readingsConverted, exactFieldMapping(field+"_exact"))
+			}
 		}
 		entryDocumentMapping.AddSubDocumentMapping("definitions", definitionDocumentMapping)
 	}
@@ -126,8 +199,34 @@ const batchSize = 10000
 
 var t2s *gocc.OpenCC
 
+// parseHomograph splits the [n] homograph suffix off a word, e.g. 一[1] -> 一, 1.
+func parseHomograph(word string) (string, int) {
+	m := homographSuffixPattern.FindStringSubmatchIndex(word)
+	if m == nil {
+		return word, 0
+	}
+
+	n, err := strconv.Atoi(word[m[2]:m[3]])
+	if err != nil {
+		return word, 0
+	}
+
+	return word[:m[0]], n
+}
+
 func augmentEntry(doc map[string]interface{}) error {
-	word := doc["word"].(string)
+	word, homograph := parseHomograph(doc["word"].(string))
+	doc["word"] = word
+	doc["word_length"] = utf8.RuneCountInString(word)
+	if homograph != 0 {
+		doc["homograph"] = homograph
+	}
+
+	// Words with placeholders are phrase templates, e.g. 撥…拉, which the bot matches against whole queries.
+	if strings.ContainsRune(word, placeholderChar) {
+		doc["is_template"] = true
+	}
+
 	simplified, err := t2s.Convert(word)
 	if err != nil {
 		return err
@@ -135,6 +234,10 @@ func augmentEntry(doc map[string]interface{}) error {
 
 	doc["simplified"] = []string{simplified}
 
+	addPinyin(doc, word)
+	addComponents(doc, word)
+	addRadicalStrokes(doc, word)
+
 	definitions := doc["definitions"].([]interface{})
 	for _, def := range definitions {
 		def := def.(map[string]interface{})
@@ -145,40 +248,133 @@ func augmentEntry(doc map[string]interface{}) error {
 			readingsNoDiacritics[i] = diacriticsReplacer.Replace(reading.(string))
 		}
 		def["readings_no_diacritics"] = readingsNoDiacritics
+
+		// Meanings list senses separated by commas or semicolons, e.g. Good, To love.
+		var senses []string
+		meanings, _ := def["meanings"].([]interface{})
+		for _, meaning := range meanings {
+			for _, sense := range strings.FieldsFunc(meaning.(string), isSenseSeparator) {
+				if sense = strings.ToLower(strings.TrimSpace(sense)); sense != "" {
+					senses = append(senses, sense)
+				}
+			}
+		}
+		def["senses"] = senses
+
+		// Also index readings in other romanizations, so they can be searched in whichever one the user knows.
+		for _, system := range romanization.Converted {
+			converted := make([]string, len(readings))
+			for i, reading := range readings {
+				converted[i] = romanization.Convert(reading.(string), system)
+			}
+			def["readings_"+string(system)] = converted
+		}
 	}
 
 	return nil
 }
 
-func importFile(idx bleve.Index, path string) (int, error) {
-	stdoutEncoder := json.NewEncoder(os.Stdout)
-	source := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+func isSenseSeparator(r rune) bool {
+	return r == ',' || r == ';'
+}
+
+type rawEntry struct {
+	id    string
+	lines []int
+	doc   map[string]interface{}
+}
 
+// readFile reads every entry in a dictionary, keyed by document ID. Entries whose IDs collide are merged, or reported
+// as an error if merging is disabled.
+func readFile(path string, source string) ([]*rawEntry, error) {
 	input, err := os.Open(path)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	defer input.Close()
 
-	batch := idx.NewBatch()
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	var entries []*rawEntry
+	byID := make(map[string]*rawEntry)
+
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		if p := lintEntry(line).firstError(); p != nil {
+			return nil, fmt.Errorf("invalid entry on line %d: %s", lineno, p.Message)
+		}
 
-	dec := json.NewDecoder(input)
-	i := 0
-	for {
-		i++
 		var doc map[string]interface{}
+		if err := json.Unmarshal(line, &doc); err != nil {
+			return nil, fmt.Errorf("failed to process entry on line %d: %w", lineno, err)
+		}
+
+		id := source + ":" + doc["word"].(string)
 
-		err := dec.Decode(&doc)
-		if err == io.EOF {
-			break
+		if e, ok := byID[id]; ok {
+			e.lines = append(e.lines, lineno)
+			e.doc["definitions"] = append(e.doc["definitions"].([]interface{}), doc["definitions"].([]interface{})...)
+			continue
 		}
 
-		if err != nil {
-			return i, fmt.Errorf("failed to process entry %d: %w", i, err)
+		e := &rawEntry{id: id, lines: []int{lineno}, doc: doc}
+		byID[id] = e
+		entries = append(entries, e)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var collisions []string
+	for _, e := range entries {
+		if len(e.lines) > 1 {
+			collisions = append(collisions, fmt.Sprintf("%s on lines %s", e.doc["word"], joinInts(e.lines, ", ")))
 		}
+	}
+
+	if len(collisions) > 0 {
+		if *onDuplicate != "merge" {
+			return nil, fmt.Errorf("%d words occur more than once: %s", len(collisions), strings.Join(collisions, "; "))
+		}
+		log.Printf("Merged %d words that occur more than once: %s", len(collisions), strings.Join(collisions, "; "))
+	}
+
+	return entries, nil
+}
+
+func joinInts(ns []int, sep string) string {
+	parts := make([]string, len(ns))
+	for i, n := range ns {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, sep)
+}
+
+// importFile indexes every entry in a dictionary whose hash differs from the one in prev, if given, and records the hash
+// of every entry in next. It returns the number of entries read and the number indexed.
+func importFile(idx bleve.Index, path string, prev *importState, next *importState) (int, int, error) {
+	stdoutEncoder := json.NewEncoder(os.Stdout)
+	source := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	entries, err := readFile(path, source)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	batch := idx.NewBatch()
+
+	changed := 0
+	for i, e := range entries {
+		doc := e.doc
 
 		if err := augmentEntry(doc); err != nil {
-			return i, fmt.Errorf("failed to augment entry %d: %w", i, err)
+			return i, changed, fmt.Errorf("failed to augment entry on line %d: %w", e.lines[0], err)
 		}
 
 		doc["source"] = source
@@ -189,32 +385,61 @@ func importFile(idx bleve.Index, path string) (int, error) {
 
 		doc["_type"] = "entry"
 
-		if err := batch.Index(doc["source"].(string)+":"+doc["word"].(string), doc); err != nil {
-			return i, fmt.Errorf("failed to index entry %d: %w", i, err)
+		hash, err := hashJSON(doc)
+		if err != nil {
+			return i, changed, fmt.Errorf("failed to hash entry on line %d: %w", e.lines[0], err)
+		}
+		next.Hashes[e.id] = hash
+
+		if prev != nil && prev.Hashes[e.id] == hash {
+			continue
+		}
+		changed++
+
+		if err := batch.Index(e.id, doc); err != nil {
+			return i, changed, fmt.Errorf("failed to index entry on line %d: %w", e.lines[0], err)
 		}
 
-		if i%batchSize == 0 {
+		if batch.Size() >= batchSize {
 			if err := idx.Batch(batch); err != nil {
-				return i, err
+				return i, changed, err
 			}
 
-			log.Printf("Indexed %d entries from %s.", i, path)
+			log.Printf("Indexed %d changed entries of the first %d in %s.", changed, i+1, path)
 
 			batch = idx.NewBatch()
 		}
 	}
 
 	if err := idx.Batch(batch); err != nil {
-		return i, err
+		return len(entries), changed, err
 	}
 
-	return i, nil
+	return len(entries), changed, nil
 }
 
 func main() {
 
 	flag.Parse()
 
+	if *onDuplicate != "merge" && *onDuplicate != "fail" {
+		log.Fatalf("-on_duplicate must be merge or fail, got %q", *onDuplicate)
+	}
+
+	switch flag.Arg(0) {
+	case "lint":
+		os.Exit(runLint(flag.Args()[1:]))
+	case "ids":
+		os.Exit(runGenerateIDS(flag.Args()[1:]))
+	case "unihan":
+		os.Exit(runGenerateUnihan(flag.Args()[1:]))
+	}
+
+	// The bot keeps the previous version open until it notices the new one, so it can't be pruned yet.
+	if *keepVersions < 2 {
+		log.Fatalf("-keep_versions must be at least 2, so the version the bot has open isn't removed, got %d", *keepVersions)
+	}
+
 	var err error
 
 	t2s, err = gocc.New("t2s")
@@ -222,17 +447,59 @@ func main() {
 		log.Fatalf("Error in gocc t2s: %s", err)
 	}
 
+	ids, err = loadIDS(*idsPath)
+	if err != nil {
+		log.Fatalf("Failed to load IDS database: %s", err)
+	}
+
+	radicalStrokes, err = loadRadicalStrokes(*unihanPath)
+	if err != nil {
+		log.Fatalf("Failed to load Unihan data: %s", err)
+	}
+
 	mapping, err := buildIndexMapping()
 	if err != nil {
 		log.Fatalf("Failed to build index mapping: %s", err)
 	}
 
-	os.RemoveAll(*indexPath)
-	idx, err := bleve.New(*indexPath, mapping)
+	if isUnversionedIndex(*indexPath) {
+		log.Printf("Removing unversioned index at %s", *indexPath)
+		os.RemoveAll(*indexPath)
+	}
+
+	if err := os.MkdirAll(*indexPath, 0755); err != nil {
+		log.Fatalf("Failed to create index path: %s", err)
+	}
+
+	mappingHash, err := hashMapping(mapping)
 	if err != nil {
-		log.Fatalf("Failed to open index: %s", err)
+		log.Fatalf("Failed to hash index mapping: %s", err)
 	}
 
+	versionPath := newVersionPath(*indexPath)
+
+	var idx bleve.Index
+	var prev *importState
+	if *incremental {
+		idx, prev, err = openIncremental(*indexPath, versionPath, mappingHash)
+		if err != nil {
+			log.Fatalf("Failed to open index for incremental import: %s", err)
+		}
+
+		if idx == nil {
+			log.Printf("No index to update incrementally, rebuilding from scratch")
+		}
+	}
+
+	if idx == nil {
+		idx, err = bleve.New(versionPath, mapping)
+		if err != nil {
+			log.Fatalf("Failed to open index: %s", err)
+		}
+	}
+
+	next := newImportState(mappingHash)
+
 	inputs, err := os.ReadDir(*inputPath)
 	if err != nil {
 		wd, _ := os.Getwd()
@@ -240,6 +507,11 @@ func main() {
 		log.Fatalf("Failed to list inputs: %s", err)
 	}
 
+	commands := make(map[string]string)
+
+	// Totals over every dictionary, for the summary.
+	reindexed, deleted := 0, 0
+
 	for _, fi := range inputs {
 		path := filepath.Join(*inputPath, fi.Name())
 
@@ -247,11 +519,74 @@ func main() {
 			continue
 		}
 
+		source := strings.TrimSuffix(fi.Name(), filepath.Ext(path))
+
+		m, err := manifest.Load(manifest.Path(path))
+		if err != nil {
+			log.Fatalf("Failed to load manifest for %s: %s", path, err)
+		}
+
+		if other, ok := commands[m.Command]; ok {
+			log.Fatalf("Dictionaries %s and %s both use the command /%s", other, source, m.Command)
+		}
+		commands[m.Command] = source
+
 		log.Printf("Indexing file %s", path)
-		n, err := importFile(idx, path)
+		n, changed, err := importFile(idx, path, prev, next)
 		if err != nil {
 			log.Fatalf("Failed to process file %s: %s", path, err)
 		}
-		log.Printf("Indexed %d entries from %s", n, fi.Name())
+		log.Printf("Indexed %d changed entries of %d in %s", changed, n, fi.Name())
+		reindexed += changed
+
+		rawManifest, err := json.Marshal(m)
+		if err != nil {
+			log.Fatalf("Failed to encode manifest for %s: %s", path, err)
+		}
+
+		if err := idx.SetInternal([]byte(manifest.KeyPrefix+source), rawManifest); err != nil {
+			log.Fatalf("Failed to store manifest for %s: %s", path, err)
+		}
+	}
+
+	if prev != nil {
+		batch := idx.NewBatch()
+		removed := prev.removedIDs(next)
+		for _, id := range removed {
+			batch.Delete(id)
+		}
+
+		if err := idx.Batch(batch); err != nil {
+			log.Fatalf("Failed to delete removed entries: %s", err)
+		}
+		deleted = len(removed)
+
+		sources := next.sources()
+		for source := range prev.sources() {
+			if !sources[source] {
+				if err := idx.DeleteInternal([]byte(manifest.KeyPrefix + source)); err != nil {
+					log.Fatalf("Failed to delete manifest for %s: %s", source, err)
+				}
+			}
+		}
+	}
+
+	log.Printf("Reindexed %d changed entries and deleted %d removed entries", reindexed, deleted)
+
+	if err := next.save(idx); err != nil {
+		log.Fatalf("Failed to store import state: %s", err)
+	}
+
+	if err := idx.Close(); err != nil {
+		log.Fatalf("Failed to close index: %s", err)
+	}
+
+	if err := publishVersion(*indexPath, versionPath); err != nil {
+		log.Fatalf("Failed to publish index: %s", err)
+	}
+	log.Printf("Published %s", versionPath)
+
+	if err := pruneVersions(*indexPath, *keepVersions); err != nil {
+		log.Printf("Failed to prune old versions: %s", err)
 	}
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/mozillazg/go-pinyin"
+)
+
+// maxPinyinReadings bounds how many Mandarin readings a word gets, since every character with more than one reading
+// multiplies them.
+const maxPinyinReadings = 8
+
+// addPinyinFieldMappings adds the Mandarin readings of words: pinyin with tone marks for display, and with tone
+// numbers and without tones for search.
+func addPinyinFieldMappings(dm *mapping.DocumentMapping) {
+	display := bleve.NewTextFieldMapping()
+	display.Index = false
+	display.IncludeInAll = false
+	dm.AddFieldMappingsAt("pinyin", display)
+
+	for _, field := range []string{"pinyin_numbered", "pinyin_toneless"} {
+		fm := bleve.NewTextFieldMapping()
+		fm.Analyzer = "whitespace_tokenize"
+		fm.Store = false
+		fm.IncludeInAll = false
+		dm.AddFieldMappingsAt(field, fm)
+	}
+}
+
+// addPinyin adds the Mandarin readings of the characters in word to doc, e.g. rè tiān, re4 tian1 and re tian for 熱天.
+func addPinyin(doc map[string]interface{}, word string) {
+	marked := mandarinReadings(word, pinyin.Tone)
+	if len(marked) == 0 {
+		return
+	}
+
+	numbered := mandarinReadings(word, pinyin.Tone3)
+	toneless := mandarinReadings(word, pinyin.Normal)
+
+	doc["pinyin"] = marked
+	doc["pinyin_numbered"] = numbered
+	doc["pinyin_toneless"] = toneless
+}
+
+// mandarinReadings returns the readings of word in style, combining every reading of characters that have more than
+// one. Characters without a Mandarin reading, like placeholders, are skipped.
+func mandarinReadings(word string, style int) []string {
+	args := pinyin.NewArgs()
+	args.Style = style
+	args.Heteronym = true
+
+	readings := []string{""}
+	for _, syllables := range pinyin.Pinyin(word, args) {
+		syllables = dedupe(syllables)
+
+		var next []string
+		for _, r := range readings {
+			for _, s := range syllables {
+				if len(next) == maxPinyinReadings {
+					break
+				}
+				next = append(next, strings.TrimSpace(r+" "+s))
+			}
+		}
+		readings = next
+	}
+
+	if len(readings) == 1 && readings[0] == "" {
+		return nil
+	}
+	return readings
+}
+
+// dedupe removes repeated syllables, which the toneless style gives for characters read with different tones.
+func dedupe(ss []string) []string {
+	seen := make(map[string]bool, len(ss))
+	out := ss[:0:0]
+	for _, s := range ss {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
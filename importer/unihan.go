@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+)
+
+// radicalStrokePattern matches a kRSUnicode value, e.g. 30.13, or 120'.3 for a character with a simplified radical.
+var radicalStrokePattern = regexp.MustCompile(`^(\d+)'*\.(-?\d+)$`)
+
+// radicalStrokes maps characters to their Kangxi radical numbers and residual stroke counts, e.g. 噥 -> 30.13.
+var radicalStrokes map[rune][]string
+
+// loadRadicalStrokes reads the kRSUnicode field of Unihan data: a code point, the field name and its value, separated
+// by tabs. Simplified radicals count as the radicals they simplify.
+func loadRadicalStrokes(path string) (map[rune][]string, error) {
+	rs := make(map[rune][]string)
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		log.Printf("No Unihan data at %s, characters won't be browsable by radical", path)
+		return rs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected a code point, a field and a value", path, lineNum)
+		}
+
+		if fields[1] != "kRSUnicode" {
+			continue
+		}
+
+		cp, err := strconv.ParseUint(strings.TrimPrefix(fields[0], "U+"), 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid code point %q: %w", path, lineNum, fields[0], err)
+		}
+
+		for _, v := range strings.Fields(fields[2]) {
+			m := radicalStrokePattern.FindStringSubmatch(v)
+			if m == nil {
+				return nil, fmt.Errorf("%s:%d: invalid radical-stroke count %q", path, lineNum, v)
+			}
+
+			// A few characters are written with fewer strokes than their radical, which can't be browsed to.
+			if strings.HasPrefix(m[2], "-") {
+				continue
+			}
+
+			rs[rune(cp)] = append(rs[rune(cp)], m[1]+"."+m[2])
+		}
+	}
+
+	return rs, scanner.Err()
+}
+
+// addRadicalFieldMappings adds the radical-stroke counts of single characters, for /radical.
+func addRadicalFieldMappings(dm *mapping.DocumentMapping) {
+	fm := bleve.NewTextFieldMapping()
+	fm.Analyzer = "single_tokenize"
+	fm.Store = false
+	fm.IncludeInAll = false
+	dm.AddFieldMappingsAt("radical_strokes", fm)
+}
+
+// addRadicalStrokes adds the radical-stroke counts of word to doc, if it's a single character.
+func addRadicalStrokes(doc map[string]interface{}, word string) {
+	runes := []rune(word)
+	if len(runes) != 1 {
+		return
+	}
+
+	if rs, ok := radicalStrokes[runes[0]]; ok {
+		doc["radical_strokes"] = rs
+	}
+}
+
+// unihanFields are the Unihan fields kept for the characters in the dictionaries.
+var unihanFields = map[string]bool{"kRSUnicode": true, "kTotalStrokes": true}
+
+// unihanLine is a line of Unihan data: a character, a field and its value.
+type unihanLine struct {
+	char  rune
+	field string
+	value string
+}
+
+// selectUnihan returns the lines of the Unihan data at path with the fields in unihanFields for chars.
+func selectUnihan(path string, chars map[rune]bool) ([]unihanLine, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []unihanLine
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected a code point, a field and a value", path, lineNum)
+		}
+
+		if !unihanFields[fields[1]] {
+			continue
+		}
+
+		cp, err := strconv.ParseUint(strings.TrimPrefix(fields[0], "U+"), 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid code point %q: %w", path, lineNum, fields[0], err)
+		}
+
+		if chars[rune(cp)] {
+			lines = append(lines, unihanLine{char: rune(cp), field: fields[1], value: fields[2]})
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+const unihanHeader = `# Radical-stroke counts, used to browse characters by radical with /radical.
+#
+# Each line is a code point, the kRSUnicode field and the character's Kangxi radical number and residual stroke count,
+# separated by tabs, in the same format as Unihan_IRGSources.txt from the Unicode Character Database
+# (https://www.unicode.org/charts/unihan.html). An apostrophe after the radical number marks a simplified form of the
+# radical. Other fields, such as kTotalStrokes, and lines starting with # are ignored.
+#
+# Generated by importer unihan from %s, keeping the characters in the dictionaries.
+# Run it again after adding words with new characters.
+`
+
+// runGenerateUnihan writes the kRSUnicode and kTotalStrokes fields of the characters in the dictionaries from the
+// Unihan data at paths to the Unihan data the importer reads. It returns the exit code.
+func runGenerateUnihan(paths []string) int {
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: importer unihan <Unihan data>...")
+		return 2
+	}
+
+	chars, err := dictionaryCharacters(*inputPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read dictionaries: %s\n", err)
+		return 2
+	}
+
+	var lines []unihanLine
+	var names []string
+	for _, path := range paths {
+		ls, err := selectUnihan(path, chars)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read Unihan data: %s\n", err)
+			return 2
+		}
+		lines = append(lines, ls...)
+		names = append(names, filepath.Base(path))
+	}
+
+	// Unihan data is sorted by code point, then field, so generated files diff cleanly against each other.
+	sort.SliceStable(lines, func(i int, j int) bool {
+		if lines[i].char != lines[j].char {
+			return lines[i].char < lines[j].char
+		}
+		return lines[i].field < lines[j].field
+	})
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, unihanHeader, strings.Join(names, ", "))
+	counted := make(map[rune]bool)
+	for _, l := range lines {
+		fmt.Fprintf(&out, "U+%04X\t%s\t%s\n", l.char, l.field, l.value)
+		if l.field == "kRSUnicode" {
+			counted[l.char] = true
+		}
+	}
+
+	if err := os.WriteFile(*unihanPath, out.Bytes(), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write Unihan data: %s\n", err)
+		return 2
+	}
+
+	// Radicals and strokes used as components aren't Unihan characters.
+	han, missing := 0, 0
+	for r := range chars {
+		if unicode.Is(unicode.Han, r) {
+			han++
+			if !counted[r] {
+				missing++
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s; %d of %d characters in the dictionaries have no radical-stroke count\n", *unihanPath, missing, han)
+	return 0
+}
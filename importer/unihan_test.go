@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSelectUnihan(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "Unihan_IRGSources.txt", strings.Join([]string{
+		"# Unihan_IRGSources.txt",
+		"U+5102\tkIRG_GSource\tG3-2A2E",
+		"U+5102\tkRSUnicode\t9.13",
+		"U+5102\tkTotalStrokes\t15",
+		"U+8FB2\tkRSUnicode\t161.6",
+		"U+8FB2\tkTotalStrokes\t13",
+		"U+4F60\tkRSUnicode\t9.5",
+		"",
+	}, "\n"))
+
+	lines, err := selectUnihan(path, map[rune]bool{'儂': true, '你': true, '尔': true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []unihanLine{
+		{'儂', "kRSUnicode", "9.13"},
+		{'儂', "kTotalStrokes", "15"},
+		{'你', "kRSUnicode", "9.5"},
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("selectUnihan() = %+v, want %+v", lines, want)
+	}
+
+	bad := writeTestFile(t, t.TempDir(), "bad.txt", "U+5102 kRSUnicode 9.13\n")
+	if _, err := selectUnihan(bad, nil); err == nil {
+		t.Errorf("selectUnihan() of a line without tabs succeeded")
+	}
+}
+
+func TestLoadRadicalStrokes(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "unihan.txt", strings.Join([]string{
+		"U+5102\tkRSUnicode\t9.13",
+		"U+5102\tkTotalStrokes\t15",
+		"U+8BF4\tkRSUnicode\t149'.7",
+		"U+4E28\tkRSUnicode\t2.0 2.-1",
+		"",
+	}, "\n"))
+
+	rs, err := loadRadicalStrokes(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[rune][]string{'儂': {"9.13"}, '说': {"149.7"}, '丨': {"2.0"}}
+	if !reflect.DeepEqual(rs, want) {
+		t.Errorf("loadRadicalStrokes() = %q, want %q", rs, want)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// currentLink is the symlink in the index path that points at the version of the index the bot should serve.
+const currentLink = "current"
+
+// versionFormat is the time format versions of the index are named with, and versionPattern matches those names.
+const versionFormat = "20060102T150405.000000000"
+
+var versionPattern = regexp.MustCompile(`^\d{8}T\d{6}\.\d{9}$`)
+
+// newVersionPath returns a fresh directory to build a version of the index in.
+func newVersionPath(root string) string {
+	return filepath.Join(root, time.Now().UTC().Format(versionFormat))
+}
+
+// currentVersionPath returns the version of the index the current symlink points at, if any.
+func currentVersionPath(root string) (string, bool) {
+	target, err := os.Readlink(filepath.Join(root, currentLink))
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(root, target), true
+}
+
+// publishVersion atomically points the current symlink at version.
+func publishVersion(root string, version string) error {
+	tmp := filepath.Join(root, currentLink+".tmp")
+	os.Remove(tmp)
+
+	if err := os.Symlink(filepath.Base(version), tmp); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(root, currentLink))
+}
+
+// pruneVersions removes every version except the current one and the keep-1 versions before it. Versions newer than
+// the current one are left over from failed imports. Directories not named like versions are left alone.
+//
+// The bot only notices a new version when it next polls the current symlink, so a version it still has open can be
+// removed if more than keep-1 imports are published between its polls.
+func pruneVersions(root string, keep int) error {
+	current, ok := currentVersionPath(root)
+	if !ok {
+		return nil
+	}
+
+	fis, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+
+	var versions []string
+	for _, fi := range fis {
+		if fi.IsDir() && versionPattern.MatchString(fi.Name()) {
+			versions = append(versions, fi.Name())
+		}
+	}
+	sort.Strings(versions)
+
+	currentIndex := sort.SearchStrings(versions, filepath.Base(current))
+	for i, v := range versions {
+		if i <= currentIndex && i > currentIndex-keep {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(root, v)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isUnversionedIndex reports whether path holds an index built in place by an older importer.
+func isUnversionedIndex(path string) bool {
+	_, err := os.Stat(filepath.Join(path, "index_meta.json"))
+	return err == nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPruneVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []string
+		current  string
+		keep     int
+		want     []string
+	}{
+		{
+			name:     "keeps the current version and the one before it",
+			versions: []string{"20240101T000000.000000000", "20240102T000000.000000000", "20240103T000000.000000000"},
+			current:  "20240103T000000.000000000",
+			keep:     2,
+			want:     []string{"20240102T000000.000000000", "20240103T000000.000000000"},
+		},
+		{
+			name:     "removes versions left over from failed imports",
+			versions: []string{"20240101T000000.000000000", "20240102T000000.000000000", "20240103T000000.000000000", "20240104T000000.000000000"},
+			current:  "20240102T000000.000000000",
+			keep:     2,
+			want:     []string{"20240101T000000.000000000", "20240102T000000.000000000"},
+		},
+		{
+			name:     "keeps fewer versions than there are",
+			versions: []string{"20240101T000000.000000000", "20240102T000000.000000000"},
+			current:  "20240102T000000.000000000",
+			keep:     3,
+			want:     []string{"20240101T000000.000000000", "20240102T000000.000000000"},
+		},
+		{
+			name:     "leaves directories that aren't versions",
+			versions: []string{"20240101T000000.000000000", "20240102T000000.000000000", "backup", "lost+found"},
+			current:  "20240102T000000.000000000",
+			keep:     1,
+			want:     []string{"20240102T000000.000000000", "backup", "lost+found"},
+		},
+		{
+			name:     "leaves everything without a current version",
+			versions: []string{"20240101T000000.000000000", "20240102T000000.000000000"},
+			keep:     2,
+			want:     []string{"20240101T000000.000000000", "20240102T000000.000000000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, v := range tt.versions {
+				if err := os.Mkdir(filepath.Join(root, v), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.current != "" {
+				if err := publishVersion(root, filepath.Join(root, tt.current)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := pruneVersions(root, tt.keep); err != nil {
+				t.Fatal(err)
+			}
+
+			fis, err := os.ReadDir(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, fi := range fis {
+				if fi.IsDir() {
+					got = append(got, fi.Name())
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pruneVersions() kept %q, want %q", got, tt.want)
+			}
+
+			if tt.current != "" {
+				if current, ok := currentVersionPath(root); !ok || filepath.Base(current) != tt.current {
+					t.Errorf("current version is %q, want %q", current, tt.current)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// currentLink is the symlink the importer points at the newest version of the index.
+const currentLink = "current"
+
+// loadedIndex is an open version of the index, along with the dictionaries in it.
+type loadedIndex struct {
+	bleve.Index
+	path         string
+	dictionaries []*dictionary
+	templates    []*phraseTemplate
+	lexicon      *lexicon
+
+	// refs counts the lookups still using the index, so it can be closed once they finish after being swapped out.
+	refs sync.WaitGroup
+}
+
+// resolveIndexPath returns the version of the index to serve from root. Indexes built in place by older importers
+// have no versions, and are served directly.
+func resolveIndexPath(root string) (string, error) {
+	target, err := os.Readlink(filepath.Join(root, currentLink))
+	if os.IsNotExist(err) {
+		return root, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(root, target)
+	}
+	return target, nil
+}
+
+func openIndex(path string) (*loadedIndex, error) {
+	index, err := bleve.OpenUsing(path, map[string]interface{}{"read_only": true})
+	if err != nil {
+		return nil, err
+	}
+
+	dictionaries, err := loadDictionaries(index)
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+
+	templates, err := loadTemplates(index)
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+
+	lexicon, err := loadLexicon(index)
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+
+	return &loadedIndex{Index: index, path: path, dictionaries: dictionaries, templates: templates, lexicon: lexicon}, nil
+}
+
+// acquireIndex returns the current index, which stays open until release is called.
+func (b *Bot) acquireIndex() (idx *loadedIndex, release func()) {
+	b.indexMu.Lock()
+	defer b.indexMu.Unlock()
+
+	idx = b.index
+	idx.refs.Add(1)
+	return idx, idx.refs.Done
+}
+
+func (b *Bot) dictionaries() []*dictionary {
+	b.indexMu.Lock()
+	defer b.indexMu.Unlock()
+
+	return b.index.dictionaries
+}
+
+// swapIndex starts serving next, and closes the previous index once nothing is using it.
+func (b *Bot) swapIndex(next *loadedIndex) {
+	b.indexMu.Lock()
+	prev := b.index
+	b.index = next
+	b.indexMu.Unlock()
+
+	if prev == nil {
+		return
+	}
+
+	go func() {
+		prev.refs.Wait()
+		if err := prev.Close(); err != nil {
+			log.Printf("Failed to close index %s: %s", prev.path, err)
+			return
+		}
+		log.Printf("Closed index %s", prev.path)
+	}()
+}
+
+// watchIndex polls root for the importer publishing a new version of the index, and swaps it in.
+func (b *Bot) watchIndex(root string, interval time.Duration) {
+	for range time.Tick(interval) {
+		path, err := resolveIndexPath(root)
+		if err != nil {
+			log.Printf("Failed to resolve index path: %s", err)
+			continue
+		}
+
+		b.indexMu.Lock()
+		current := b.index.path
+		b.indexMu.Unlock()
+
+		if path == current {
+			continue
+		}
+
+		next, err := openIndex(path)
+		if err != nil {
+			log.Printf("Failed to open index %s: %s", path, err)
+			continue
+		}
+
+		if !sameCommands(b.dictionaries(), next.dictionaries) {
+			log.Printf("Dictionaries in %s have changed, restart to update commands", path)
+		}
+
+		b.swapIndex(next)
+		log.Printf("Reloaded index from %s", path)
+	}
+}
+
+func sameCommands(a []*dictionary, b []*dictionary) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].command != b[i].command || a[i].description != b[i].description {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,16 +1,25 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
-	"github.com/blevesearch/bleve/v2"
 	"github.com/bwmarrin/discordgo"
 	"github.com/kelseyhightower/envconfig"
 
+	"github.com/GitTsubasa/gumby/romanization"
+
 	_ "github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
 	_ "github.com/blevesearch/bleve/v2/analysis/lang/en"
 	_ "github.com/blevesearch/bleve/v2/analysis/token/lowercase"
@@ -20,13 +29,30 @@ import (
 )
 
 type config struct {
-	DiscordToken string
-	IndexPath    string
+	DiscordToken   string        `required:"true"`
+	IndexPath      string        `default:"dict.bleve"`
+	ReloadInterval time.Duration `default:"10s"`
+
+	// ListenAddr switches the bot to receiving interactions over HTTP instead of the gateway.
+	ListenAddr string
+	PublicKey  string
+
+	// SessionPath persists search sessions in a bbolt database, so paging through results survives restarts.
+	SessionPath string
+	SessionTTL  time.Duration `default:"24h"`
 }
 
 type Bot struct {
-	index   bleve.Index
-	discord *discordgo.Session
+	discord   *discordgo.Session
+	publicKey ed25519.PublicKey
+
+	indexMu sync.Mutex
+	index   *loadedIndex
+
+	sessions *sessions
+
+	// httpResponses holds the pending HTTP response for interactions received over HTTP, by interaction ID.
+	httpResponses sync.Map
 }
 
 func (b *Bot) handleInteraction(i *discordgo.InteractionCreate) {
@@ -37,11 +63,29 @@ func (b *Bot) handleInteraction(i *discordgo.InteractionCreate) {
 		case "gumby":
 			b.handleHelp(i)
 		case "def":
-			b.HandleShdef(i, "")
+			b.HandleShdef(i, "", searchModeDefault)
+		case "component":
+			b.HandleShdef(i, "", searchModeComponent)
+		case "radical":
+			b.HandleRadical(i)
+		case "gloss":
+			b.HandleGloss(i)
+		case "regex":
+			b.HandleShdef(i, "", searchModeRegex)
+		case lookUpMessageCommand:
+			b.HandleLookUpMessage(i)
 		default:
-			b.HandleShdef(i, name)
+			d, ok := b.dictionaryByCommand(name)
+			if !ok {
+				log.Printf("Unknown command: %s", name)
+				return
+			}
+			b.HandleShdef(i, d.source, searchModeDefault)
 		}
 
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		b.HandleAutocomplete(i)
+
 	case discordgo.InteractionMessageComponent:
 		b.HandleComponentInteraction(i)
 	}
@@ -49,19 +93,25 @@ func (b *Bot) handleInteraction(i *discordgo.InteractionCreate) {
 
 func (b *Bot) handleHelp(i *discordgo.InteractionCreate) {
 	var fields []*discordgo.MessageEmbedField
+	for _, d := range b.dictionaries() {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "/" + d.command,
+			Value: fmt.Sprintf("%s\n_%s_\n%d entries", d.description, d.attribution(), d.entries),
+		})
+	}
 
 	sort.Slice(fields, func(i int, j int) bool {
 		return fields[i].Name < fields[j].Name
 	})
 
-	b.discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	b.respond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
 			Embeds: []*discordgo.MessageEmbed{
 				{
 					Color:       0x005BAC,
 					Title:       "Hi! I'm Gumby!",
-					Description: "I'm a Bot that looks up words in Shanghainese dictionaries! Here's a list of dictionaries you can use below, or you can use **`/def`** to search all dictionaries!",
+					Description: "I'm a Bot that looks up words in Shanghainese dictionaries! Here's a list of dictionaries you can use below, or you can use **`/def`** to search all dictionaries!\n\nTo search more precisely, limit words to a field with `word:`, `reading:`, `meaning:` or `source:`, exclude them with `-`, and combine them with `OR`, e.g. `meaning:\"to give\" -money`.",
 					Fields:      fields,
 				},
 			},
@@ -69,42 +119,40 @@ func (b *Bot) handleHelp(i *discordgo.InteractionCreate) {
 	})
 }
 
-func Handler(w http.ResponseWriter, r *http.Request) {
-	var c config
-	if err := envconfig.Process("gumby", &c); err != nil {
-		log.Fatalf("Failed to parse envconfing: %s", err)
-	}
-	// IndexPath := os.Getenv("INDEXPATH")
-	// index, err := bleve.Open(IndexPath)
-	index, err := bleve.Open("../importer/dict.bleve")
-
-	if err != nil {
-		log.Fatalf("Unable to open index: %v\n", err)
+// lookupOptions are the options of every command that looks words up.
+func lookupOptions() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:         discordgo.ApplicationCommandOptionString,
+			Name:         "query",
+			Description:  "What to look up (by word, meaning, or reading in any romanization; * and ? are wildcards)",
+			Required:     true,
+			Autocomplete: true,
+		},
+		romanizationOption(),
+		{
+			Type:        discordgo.ApplicationCommandOptionBoolean,
+			Name:        "debug",
+			Description: "Explain how results were ranked",
+		},
 	}
+}
 
-	log.Printf("Connected to database.")
-
-	DiscordToken := os.Getenv("DISCORDTOKEN")
-	discord, err := discordgo.New(DiscordToken)
-	if err != nil {
-		log.Fatalf("Unable to connect to Discord: %v\n", err)
+func romanizationOption() *discordgo.ApplicationCommandOption {
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, system := range append([]romanization.System{romanization.Church}, romanization.Converted...) {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: system.Name(), Value: string(system)})
 	}
 
-	discord.StateEnabled = false
-	discord.Identify.Intents = discordgo.IntentsGuilds
-
-	if err := discord.Open(); err != nil {
-		log.Fatalf("Unable to connect to Discord: %v\n", err)
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "romanization",
+		Description: "Romanization to show readings in",
+		Choices:     choices,
 	}
+}
 
-	discord.UpdateGameStatus(0, "/gumby for help!")
-
-	log.Printf("Connected to Discord.")
-
-	defer discord.Close()
-
-	Bot := Bot{index: index, discord: discord}
-
+func (b *Bot) commands() []*discordgo.ApplicationCommand {
 	commands := []*discordgo.ApplicationCommand{
 		{
 			Name:        "gumby",
@@ -113,17 +161,163 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		{
 			Name:        "def",
 			Description: "Look up in all dictionaries",
+			Options:     lookupOptions(),
+		},
+		{
+			Name: lookUpMessageCommand,
+			Type: discordgo.MessageApplicationCommand,
+		},
+		{
+			Name:        "component",
+			Description: "Find characters by their components, e.g. 口 and 農 for 噥",
 			Options: []*discordgo.ApplicationCommandOption{
 				{
 					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "query",
-					Description: "What to look up (by word, meaning, or reading)",
+					Name:        "components",
+					Description: "Components that are all in one character, e.g. 口農",
 					Required:    true,
 				},
+				romanizationOption(),
+			},
+		},
+		{
+			Name:        "radical",
+			Description: "Browse characters by radical and stroke count",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "radical",
+					Description: "Radical to start from, e.g. 口, 氵 or 30",
+				},
+				romanizationOption(),
+			},
+		},
+		{
+			Name:        "gloss",
+			Description: "Gloss a sentence word by word",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "sentence",
+					Description: "Sentence to gloss, e.g. 儂吃過飯了伐",
+					Required:    true,
+				},
+				romanizationOption(),
+			},
+		},
+		{
+			Name:        "regex",
+			Description: "Find words, readings or syllables matching a regular expression",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "pattern",
+					Description: "Regular expression matching a whole word, reading or syllable, e.g. [ktp]'.*ih",
+					Required:    true,
+				},
+				romanizationOption(),
 			},
 		},
 	}
 
+	// Dictionaries can't take over the commands above.
+	reserved := make(map[string]bool)
+	for _, c := range commands {
+		reserved[c.Name] = true
+	}
+
+	for _, d := range b.dictionaries() {
+		if reserved[d.command] {
+			log.Printf("Not registering command for %s: /%s is reserved", d.source, d.command)
+			continue
+		}
+
+		commands = append(commands, &discordgo.ApplicationCommand{
+			Name:        d.command,
+			Description: d.description,
+			Options:     lookupOptions(),
+		})
+	}
+
+	return commands
+}
+
+func main() {
+	var c config
+	if err := envconfig.Process("gumby", &c); err != nil {
+		log.Fatalf("Failed to parse config: %s", err)
+	}
+
+	var publicKey ed25519.PublicKey
+	if c.ListenAddr != "" {
+		if c.PublicKey == "" {
+			log.Fatalf("GUMBY_PUBLICKEY is required when GUMBY_LISTENADDR is set")
+		}
+
+		key, err := hex.DecodeString(c.PublicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			log.Fatalf("GUMBY_PUBLICKEY must be a hex-encoded Ed25519 public key")
+		}
+		publicKey = key
+	}
+
+	if err := loadVariants(); err != nil {
+		log.Fatalf("Failed to load variants: %s", err)
+	}
+
+	if _, err := os.Stat(c.IndexPath); err != nil {
+		log.Fatalf("Unable to find index at %s (set GUMBY_INDEXPATH or run the importer): %v\n", c.IndexPath, err)
+	}
+
+	indexPath, err := resolveIndexPath(c.IndexPath)
+	if err != nil {
+		log.Fatalf("Unable to resolve index %s: %v\n", c.IndexPath, err)
+	}
+
+	index, err := openIndex(indexPath)
+	if err != nil {
+		log.Fatalf("Unable to open index %s: %v\n", indexPath, err)
+	}
+
+	log.Printf("Connected to database.")
+	log.Printf("Loaded %d dictionaries.", len(index.dictionaries))
+
+	token := c.DiscordToken
+	if !strings.HasPrefix(token, "Bot ") {
+		token = "Bot " + token
+	}
+
+	discord, err := discordgo.New(token)
+	if err != nil {
+		log.Fatalf("Unable to connect to Discord: %v\n", err)
+	}
+
+	sessions, err := openSessions(c.SessionPath, c.SessionTTL)
+	if err != nil {
+		log.Fatalf("Unable to open sessions %s: %v\n", c.SessionPath, err)
+	}
+	defer sessions.store.Close()
+
+	bot := &Bot{index: index, discord: discord, publicKey: publicKey, sessions: sessions}
+	go bot.watchIndex(c.IndexPath, c.ReloadInterval)
+	go sessions.expireEvery(time.Minute)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	if c.ListenAddr != "" {
+		runHTTP(bot, c.ListenAddr, stop)
+	} else {
+		runGateway(bot, stop)
+	}
+}
+
+func runGateway(b *Bot, stop <-chan os.Signal) {
+	discord := b.discord
+
+	discord.StateEnabled = false
+	discord.Identify.Intents = discordgo.IntentsGuilds
+
 	discord.AddHandler(func(d *discordgo.Session, g *discordgo.GuildCreate) {
 		oldCmds, err := discord.ApplicationCommands(discord.State.User.ID, g.Guild.ID)
 		log.Println(discord.State.User.ID, g.Guild.ID)
@@ -140,7 +334,7 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 			log.Printf("Deleted command %s for %s", cmd.Name, g.Guild.ID)
 		}
 
-		for _, cmd := range commands {
+		for _, cmd := range b.commands() {
 			if _, err := discord.ApplicationCommandCreate(discord.State.User.ID, g.Guild.ID, cmd); err != nil {
 				log.Printf("Unable to create command %s for %s: %v\n", cmd.Name, g.Guild.ID, err)
 				continue
@@ -150,10 +344,44 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	})
 
 	discord.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		Bot.handleInteraction(i)
+		b.handleInteraction(i)
 	})
 
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt)
+	if err := discord.Open(); err != nil {
+		log.Fatalf("Unable to connect to Discord: %v\n", err)
+	}
+	defer discord.Close()
+
+	discord.UpdateGameStatus(0, "/gumby for help!")
+
+	log.Printf("Connected to Discord.")
+
+	<-stop
+}
+
+func runHTTP(b *Bot, addr string, stop <-chan os.Signal) {
+	app, err := b.discord.Application("@me")
+	if err != nil {
+		log.Fatalf("Unable to get application: %v\n", err)
+	}
+
+	if _, err := b.discord.ApplicationCommandBulkOverwrite(app.ID, "", b.commands()); err != nil {
+		log.Fatalf("Unable to register commands: %v\n", err)
+	}
+	log.Printf("Registered commands for %s", app.ID)
+
+	srv := &http.Server{Addr: addr, Handler: b}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Unable to serve HTTP: %v\n", err)
+		}
+	}()
+
+	log.Printf("Listening for interactions on %s.", addr)
+
 	<-stop
+
+	ctx, cancel := context.WithTimeout(context.Background(), interactionTimeout)
+	defer cancel()
+	srv.Shutdown(ctx)
 }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testIndex is an index of the dictionaries in this repository, shared by the tests that search it.
+var testIndex struct {
+	once  sync.Once
+	dir   string
+	index *loadedIndex
+	err   error
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+
+	if testIndex.index != nil {
+		testIndex.index.Close()
+	}
+	if testIndex.dir != "" {
+		os.RemoveAll(testIndex.dir)
+	}
+	os.Exit(code)
+}
+
+// importTestDictionaries imports the dictionaries in inputPath into an index at root with the importer.
+func importTestDictionaries(root string, inputPath string) error {
+	cmd := exec.Command("go", "run", "./importer",
+		"-index_path", root,
+		"-input_path", inputPath,
+		"-ids_path", "dictionaries/ids.txt",
+		"-unihan_path", "dictionaries/unihan.txt")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to import dictionaries: %w\n%s", err, out)
+	}
+	return nil
+}
+
+// buildTestIndex imports the dictionaries in this repository with the importer, unless GUMBY_TEST_INDEXPATH points at
+// an index that was already built from them.
+func buildTestIndex() (*loadedIndex, error) {
+	if err := loadVariants(); err != nil {
+		return nil, err
+	}
+
+	root := os.Getenv("GUMBY_TEST_INDEXPATH")
+	if root == "" {
+		dir, err := os.MkdirTemp("", "gumby-test")
+		if err != nil {
+			return nil, err
+		}
+		testIndex.dir = dir
+		root = filepath.Join(dir, "dict.bleve")
+
+		if err := importTestDictionaries(root, "dictionaries"); err != nil {
+			return nil, err
+		}
+	}
+
+	path, err := resolveIndexPath(root)
+	if err != nil {
+		return nil, err
+	}
+	return openIndex(path)
+}
+
+// newTestBot returns a bot searching the dictionaries in this repository. Importing them takes a while, so tests using
+// it are skipped in short mode.
+func newTestBot(t *testing.T) *Bot {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("skipping test that imports the dictionaries in short mode")
+	}
+
+	testIndex.once.Do(func() {
+		testIndex.index, testIndex.err = buildTestIndex()
+	})
+	if testIndex.err != nil {
+		t.Fatal(testIndex.err)
+	}
+
+	s, err := openSessions("", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.store.Close() })
+
+	return &Bot{index: testIndex.index, sessions: s}
+}
+
+// newTwoDictionaryTestBot returns a bot searching the two small dictionaries in testdata/dictionaries, which share some
+// headwords. It's skipped in short mode, like newTestBot.
+func newTwoDictionaryTestBot(t *testing.T) *Bot {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("skipping test that imports dictionaries in short mode")
+	}
+
+	if err := loadVariants(); err != nil {
+		t.Fatal(err)
+	}
+
+	root := filepath.Join(t.TempDir(), "dict.bleve")
+	if err := importTestDictionaries(root, filepath.Join("testdata", "dictionaries")); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := resolveIndexPath(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := openIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { idx.Close() })
+
+	s, err := openSessions("", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.store.Close() })
+
+	return &Bot{index: idx, sessions: s}
+}
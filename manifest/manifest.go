@@ -0,0 +1,89 @@
+// Package manifest describes dictionaries: the sidecar manifest the importer reads next to each dictionary, and stores
+// in the index for the bot.
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// KeyPrefix prefixes the internal index key each dictionary's manifest is stored under.
+const KeyPrefix = "manifest:"
+
+var validCommandName = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+var reservedCommandNames = map[string]bool{
+	"gumby":     true,
+	"def":       true,
+	"component": true,
+	"radical":   true,
+	"gloss":     true,
+	"regex":     true,
+}
+
+// Manifest describes a dictionary and the command it's looked up with.
+type Manifest struct {
+	Name         string `json:"name"`
+	Author       string `json:"author,omitempty"`
+	Year         int    `json:"year,omitempty"`
+	License      string `json:"license,omitempty"`
+	Romanization string `json:"romanization,omitempty"`
+	Command      string `json:"command"`
+	Description  string `json:"description"`
+}
+
+// Path returns the path of the sidecar manifest for a dictionary, e.g. dict.ndjson -> dict.meta.json.
+func Path(path string) string {
+	return strings.TrimSuffix(path, ".ndjson") + ".meta.json"
+}
+
+// Load reads and validates the manifest at path.
+func Load(path string) (*Manifest, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+
+	var m Manifest
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// Validate checks that m can be registered as a command.
+func (m *Manifest) Validate() error {
+	if strings.TrimSpace(m.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	if !validCommandName.MatchString(m.Command) {
+		return fmt.Errorf("command %q must be 1-32 characters of a-z, 0-9, _ or -", m.Command)
+	}
+
+	if reservedCommandNames[m.Command] {
+		return fmt.Errorf("command %q is reserved", m.Command)
+	}
+
+	if l := len([]rune(m.Description)); l == 0 || l > 100 {
+		return fmt.Errorf("description must be 1-100 characters, got %d", l)
+	}
+
+	if m.Year < 0 || m.Year > 9999 {
+		return fmt.Errorf("year %d is out of range", m.Year)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	if got, want := Path("dictionaries/dict.ndjson"), "dictionaries/dict.meta.json"; got != want {
+		t.Errorf("Path() = %q, want %q", got, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Manifest{Name: "Dictionary", Command: "dict", Description: "Look up in the dictionary"}
+
+	tests := []struct {
+		name   string
+		change func(m *Manifest)
+		err    string
+	}{
+		{"valid", func(m *Manifest) {}, ""},
+		{"no name", func(m *Manifest) { m.Name = " " }, "name is required"},
+		{"uppercase command", func(m *Manifest) { m.Command = "Dict" }, "must be 1-32 characters"},
+		{"long command", func(m *Manifest) { m.Command = strings.Repeat("d", 33) }, "must be 1-32 characters"},
+		{"reserved command", func(m *Manifest) { m.Command = "def" }, "is reserved"},
+		{"no description", func(m *Manifest) { m.Description = "" }, "description must be 1-100 characters"},
+		{"long description", func(m *Manifest) { m.Description = strings.Repeat("字", 101) }, "description must be 1-100 characters"},
+		{"negative year", func(m *Manifest) { m.Year = -1 }, "out of range"},
+	}
+
+	for _, tt := range tests {
+		m := valid
+		tt.change(&m)
+
+		err := m.Validate()
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: Validate() = %v, want no error", tt.name, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: Validate() = %v, want an error containing %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	good := filepath.Join(dir, "good.meta.json")
+	os.WriteFile(good, []byte(`{"name": "Dictionary", "command": "dict", "description": "Look up in the dictionary", "year": 1900}`), 0644)
+	if m, err := Load(good); err != nil || m.Year != 1900 {
+		t.Errorf("Load() = %+v, %v, want year 1900", m, err)
+	}
+
+	unknown := filepath.Join(dir, "unknown.meta.json")
+	os.WriteFile(unknown, []byte(`{"name": "Dictionary", "command": "dict", "description": "Look up", "editor": "x"}`), 0644)
+	if _, err := Load(unknown); err == nil {
+		t.Errorf("Load() of a manifest with an unknown field succeeded")
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/GitTsubasa/gumby/romanization"
+)
+
+// maxMergedEntries bounds how many entries sharing a headword are gathered across dictionaries.
+const maxMergedEntries = 50
+
+// headwordQuery matches the entries spelled like e, traditional or simplified.
+func headwordQuery(e entry) query.Query {
+	var qs []query.Query
+	for _, form := range append([]string{e.word}, e.simplified...) {
+		for _, field := range []string{"word_exact", "simplified_exact"} {
+			tq := bleve.NewTermQuery(form)
+			tq.SetField(field)
+			qs = append(qs, tq)
+		}
+	}
+	return bleve.NewDisjunctionQuery(qs...)
+}
+
+// sameHeadword finds the entries in every dictionary spelled like e, starting with those in e's own dictionary and then
+// in the order dictionaries are listed.
+func (b *Bot) sameHeadword(e entry) ([]result, error) {
+	idx, release := b.acquireIndex()
+	defer release()
+
+	req := newSearchRequest(headwordQuery(e), "", maxMergedEntries, 0)
+	req.SortBy([]string{"homograph", "_id"})
+
+	results, _, err := searchResults(context.Background(), idx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	rank := map[string]int{e.source: -1}
+	for i, d := range b.dictionaries() {
+		if d.source != e.source {
+			rank[d.source] = i
+		}
+	}
+	sort.SliceStable(results, func(i int, j int) bool {
+		return rank[results[i].source] < rank[results[j].source]
+	})
+
+	return results, nil
+}
+
+// countSources counts the distinct dictionaries results come from.
+func countSources(results []result) int {
+	sources := make(map[string]bool)
+	for _, r := range results {
+		sources[r.source] = true
+	}
+	return len(sources)
+}
+
+// maxCustomIDLength is the longest custom ID Discord allows a component to have.
+const maxCustomIDLength = 100
+
+// makeMergedButton makes a button to show e, the entry with id opened from page of the search kept under token,
+// alongside the entries of other dictionaries that share its headword. It reports false if no other dictionary has one,
+// or if the ID is too long to carry.
+func (b *Bot) makeMergedButton(e entry, id string, token string, page int) (discordgo.MessageComponent, bool, error) {
+	customID := customIDPrefixShdefMerged + "|" + pagePayload(token, page) + "|" + id
+	if len(customID) > maxCustomIDLength {
+		return nil, false, nil
+	}
+
+	results, err := b.sameHeadword(e)
+	if err != nil {
+		return nil, false, err
+	}
+
+	n := countSources(results)
+	if n < 2 {
+		return nil, false, nil
+	}
+
+	return discordgo.Button{
+		Emoji:    &discordgo.ComponentEmoji{Name: "📚"},
+		Label:    fmt.Sprintf("Compare %d dictionaries", n),
+		Style:    discordgo.SecondaryButton,
+		CustomID: customID,
+	}, true, nil
+}
+
+// mergedButtonRows returns the rows of components that hold a button made by makeMergedButton.
+func mergedButtonRows(components []discordgo.MessageComponent) []discordgo.MessageComponent {
+	var rows []discordgo.MessageComponent
+	for _, c := range components {
+		row, ok := c.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+
+		for _, rc := range row.Components {
+			if button, ok := rc.(*discordgo.Button); ok && strings.HasPrefix(button.CustomID, customIDPrefixShdefMerged+"|") {
+				rows = append(rows, row)
+				break
+			}
+		}
+	}
+	return rows
+}
+
+// makeMergedOutput shows the entries with ids, in order, as one embed per dictionary with its attribution. Homographs
+// in the same dictionary share its embed, each in a section of its own.
+func (b *Bot) makeMergedOutput(ids []string, entries map[string]entry, system romanization.System) []*discordgo.MessageEmbed {
+	var sources []string
+	bySource := make(map[string][]entry)
+	for _, id := range ids {
+		e, ok := entries[id]
+		if !ok {
+			continue
+		}
+
+		if _, ok := bySource[e.source]; !ok {
+			sources = append(sources, e.source)
+		}
+		bySource[e.source] = append(bySource[e.source], e)
+	}
+
+	var embeds []*discordgo.MessageEmbed
+	for _, source := range sources {
+		group := bySource[source]
+
+		embed := b.makeEntryOutput(group[0], system)
+		if len(group) > 1 {
+			sections := make([]string, len(group))
+			for i, e := range group {
+				sections[i] = fmt.Sprintf("__%s__\n%s", e.displayWord(), b.makeEntryOutput(e, system).Description)
+			}
+
+			embed.Title = group[0].word
+			embed.Description = truncate(strings.Join(sections, "\n\n"), 4096, "...")
+		}
+
+		embeds = append(embeds, embed)
+	}
+
+	return fitEmbeds(embeds)
+}
+
+// handleMerged shows an entry alongside the entries of every dictionary that share its headword. The payload is the
+// search the entry was opened from, followed by its ID.
+func (b *Bot) handleMerged(i *discordgo.InteractionCreate, rawPayload string) {
+	parts := strings.SplitN(rawPayload, "|", 3)
+	if len(parts) != 3 {
+		log.Printf("Malformed payload: %q", rawPayload)
+		return
+	}
+	searchPayload, id := parts[0]+"|"+parts[1], parts[2]
+
+	s, ok := b.loadPage(i, searchPayload)
+	if !ok {
+		return
+	}
+
+	found, err := b.findEntries([]string{id})
+	if err != nil {
+		log.Printf("Failed to get entries: %s", err)
+		return
+	}
+
+	e, ok := found[id]
+	if !ok {
+		log.Printf("Failed to get entry %s", id)
+		return
+	}
+
+	results, err := b.sameHeadword(e)
+	if err != nil {
+		log.Printf("Failed to find entries: %s", err)
+		return
+	}
+
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.id
+	}
+
+	entries, err := b.findEntries(ids)
+	if err != nil {
+		log.Printf("Failed to get entries: %s", err)
+		return
+	}
+
+	system := parseRomanization(string(s.Romanization))
+	b.updateMessage(i, &discordgo.InteractionResponseData{
+		Content: fmt.Sprintf("**%s in %s**", e.word, pluralize(countSources(results), "dictionary", "dictionaries")),
+		Embeds:  b.makeMergedOutput(ids, entries, system),
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Emoji:    &discordgo.ComponentEmoji{Name: "↩️"},
+						Label:    "Back to results",
+						Style:    discordgo.SecondaryButton,
+						CustomID: customIDPrefixShdefBack + "|" + searchPayload,
+					},
+				},
+			},
+		},
+	})
+}
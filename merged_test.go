@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestMergedButton(t *testing.T) {
+	b := newTwoDictionaryTestBot(t)
+
+	// Entries with the same headword tie across dictionaries, so only one stands out in a search narrowed to one of them.
+	data, err := b.makeShdefResponse(shdefActionGoToPage{Query: "上海", Romanization: "church", Filter: "dict"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, ok := findComponent(data.Components, customIDPrefixShdefMerged)
+	if !ok {
+		t.Fatalf("got components %q, want a button to compare dictionaries", customIDs(data.Components))
+	}
+	button := c.(discordgo.Button)
+	if button.Label != "Compare 2 dictionaries" {
+		t.Errorf("got label %q, want %q", button.Label, "Compare 2 dictionaries")
+	}
+	if len(button.CustomID) > maxCustomIDLength {
+		t.Errorf("custom ID %q is %d characters, want at most %d", button.CustomID, len(button.CustomID), maxCustomIDLength)
+	}
+
+	merged := handleComponent(t, b, data, button.CustomID)
+	if len(merged.Embeds) != 2 {
+		t.Errorf("comparing dictionaries showed %d embeds, want 2", len(merged.Embeds))
+	}
+
+	// The entry shown with the first page stays on the next, and so does its button.
+	_, payload, _ := strings.Cut(button.CustomID, "|")
+	token, _, _ := strings.Cut(payload, "|")
+	next := handleComponent(t, b, data, customIDPrefixShdefGoToPage+"|"+pagePayload(token, 1))
+	if len(next.Embeds) != 1 || next.Embeds[0].Title != data.Embeds[0].Title {
+		t.Errorf("got embeds %+v on the next page, want the entry from the first", next.Embeds)
+	}
+	if len(mergedButtonRows(next.Components)) != 1 {
+		t.Errorf("got components %+v on the next page, want the button to compare dictionaries", next.Components)
+	}
+}
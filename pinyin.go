@@ -0,0 +1,180 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/mozillazg/go-pinyin"
+)
+
+// pinyinPattern matches queries that could be Mandarin pinyin, with tone marks, tone numbers or no tones.
+var pinyinPattern = regexp.MustCompile(`^[a-zü:'āáǎàēéěèīíǐìōóǒòūúǔùǖǘǚǜ1-5 ]+$`)
+
+// toneMarks maps each vowel with a tone mark to the vowel and its tone number.
+var toneMarks = map[rune]struct {
+	vowel rune
+	tone  byte
+}{
+	'ā': {'a', '1'}, 'á': {'a', '2'}, 'ǎ': {'a', '3'}, 'à': {'a', '4'},
+	'ē': {'e', '1'}, 'é': {'e', '2'}, 'ě': {'e', '3'}, 'è': {'e', '4'},
+	'ī': {'i', '1'}, 'í': {'i', '2'}, 'ǐ': {'i', '3'}, 'ì': {'i', '4'},
+	'ō': {'o', '1'}, 'ó': {'o', '2'}, 'ǒ': {'o', '3'}, 'ò': {'o', '4'},
+	'ū': {'u', '1'}, 'ú': {'u', '2'}, 'ǔ': {'u', '3'}, 'ù': {'u', '4'},
+	'ǖ': {'v', '1'}, 'ǘ': {'v', '2'}, 'ǚ': {'v', '3'}, 'ǜ': {'v', '4'},
+}
+
+// pinyinSyllables are the syllables of Mandarin without tones, with ü written v, and maxPinyinSyllableLength is the
+// length of the longest. They're those of the readings go-pinyin gives characters, as in the index.
+var pinyinSyllables, maxPinyinSyllableLength = loadPinyinSyllables()
+
+func loadPinyinSyllables() (map[string]bool, int) {
+	syllables := make(map[string]bool)
+	longest := 0
+	for _, readings := range pinyin.PinyinDict {
+		for _, reading := range strings.Split(readings, ",") {
+			syllable, _ := stripToneMarks(reading)
+			if syllable == "" || strings.Trim(syllable, "abcdefghijklmnopqrstuvwxyz") != "" {
+				continue
+			}
+			syllables[syllable] = true
+			longest = max(longest, len(syllable))
+		}
+	}
+	return syllables, longest
+}
+
+// stripToneMarks returns s without tone marks and with ü written v, along with the number of the last tone marked, or
+// 0 if none is.
+func stripToneMarks(s string) (string, byte) {
+	var sb strings.Builder
+	var tone byte
+	for _, r := range s {
+		if m, ok := toneMarks[r]; ok {
+			sb.WriteRune(m.vowel)
+			tone = m.tone
+			continue
+		}
+		if r == 'ü' {
+			r = 'v'
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String(), tone
+}
+
+// segmentPinyin splits s, pinyin without tones written without spaces, into as few syllables as it can, e.g. xiexie ->
+// xie xie and xian -> xian. s is returned whole if it can't be split into syllables.
+func segmentPinyin(s string) []string {
+	// fewest[i] is the fewest syllables s[i:] splits into, or -1 if it can't be split, and next[i] is where the first of
+	// them ends.
+	fewest := make([]int, len(s)+1)
+	next := make([]int, len(s)+1)
+	for i := len(s) - 1; i >= 0; i-- {
+		fewest[i] = -1
+
+		// Longer syllables are tried first, so that they win ties.
+		for j := min(len(s), i+maxPinyinSyllableLength); j > i; j-- {
+			if fewest[j] < 0 || !pinyinSyllables[s[i:j]] {
+				continue
+			}
+			if fewest[i] < 0 || fewest[j]+1 < fewest[i] {
+				fewest[i] = fewest[j] + 1
+				next[i] = j
+			}
+		}
+	}
+
+	if fewest[0] < 0 {
+		return []string{s}
+	}
+
+	var syllables []string
+	for i := 0; i < len(s); i = next[i] {
+		syllables = append(syllables, s[i:next[i]])
+	}
+	return syllables
+}
+
+// numberedPinyin converts each syllable of q to pinyin with tone numbers, e.g. rè tiān -> re4 tian1. ü is written v,
+// and the neutral tone has no number, as in the index. Syllables may be run together, e.g. shang4hai3 or xiexie, and
+// lone neutral tone numbers are dropped.
+func numberedPinyin(q string) []string {
+	q = strings.NewReplacer("u:", "v", "'", " ").Replace(strings.ToLower(q))
+
+	var syllables []string
+	for _, s := range strings.Fields(q) {
+		// A tone number ends the syllable before it, e.g. shang4hai3 -> shang4 hai3.
+		for s != "" {
+			run, tone := s, byte(0)
+			if end := strings.IndexAny(s, "12345"); end >= 0 {
+				run, tone, s = s[:end], s[end], s[end+1:]
+			} else {
+				s = ""
+			}
+
+			// Each letter keeps its tone mark, so that the syllable it ends up in gets its tone, e.g. shànghǎi -> shang4
+			// hai3.
+			var letters strings.Builder
+			var marks []byte
+			for _, r := range run {
+				letter, mark := stripToneMarks(string(r))
+				letters.WriteString(letter)
+				for range len(letter) {
+					marks = append(marks, mark)
+				}
+			}
+
+			parts := segmentPinyin(letters.String())
+			start := 0
+			for i, part := range parts {
+				syllable := part
+				for _, mark := range marks[start : start+len(part)] {
+					if mark != 0 {
+						syllable = part + string(mark)
+					}
+				}
+				start += len(part)
+
+				if i == len(parts)-1 && tone != 0 && tone != '5' {
+					syllable = part + string(tone)
+				}
+				if syllable == "" {
+					continue
+				}
+				syllables = append(syllables, syllable)
+			}
+		}
+	}
+
+	return syllables
+}
+
+// pinyinQuery matches q as Mandarin pinyin against the Mandarin readings of words, or returns nil if q can't be pinyin.
+// Tones are only matched if every syllable has one.
+func pinyinQuery(q string, boost float64) query.Query {
+	if !pinyinPattern.MatchString(strings.ToLower(q)) {
+		return nil
+	}
+
+	syllables := numberedPinyin(q)
+	if len(syllables) == 0 {
+		return nil
+	}
+
+	field := "pinyin_numbered"
+	for _, s := range syllables {
+		if len(s) == 0 || !strings.ContainsAny(s[len(s)-1:], "1234") {
+			field = "pinyin_toneless"
+			break
+		}
+	}
+
+	if field == "pinyin_toneless" {
+		for i, s := range syllables {
+			syllables[i] = strings.TrimRight(s, "1234")
+		}
+	}
+
+	return boostedPhraseQuery(strings.Join(syllables, " "), field, boost)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+func TestNumberedPinyin(t *testing.T) {
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"rè tiān", []string{"re4", "tian1"}},
+		{"re4 tian1", []string{"re4", "tian1"}},
+		{"Nǚ", []string{"nv3"}},
+		{"nu:3", []string{"nv3"}},
+		{"ma5", []string{"ma"}},
+		{"shang4hai3", []string{"shang4", "hai3"}},
+		{"shànghǎi", []string{"shang4", "hai3"}},
+		{"xiexie", []string{"xie", "xie"}},
+		{"chifan", []string{"chi", "fan"}},
+		{"nǚrén", []string{"nv3", "ren2"}},
+		{"xian", []string{"xian"}},
+		{"xi'an", []string{"xi", "an"}},
+		{"hello", []string{"hello"}},
+		{"ni3 5", []string{"ni3"}},
+		{"5", nil},
+		{"5 5", nil},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		if got := numberedPinyin(tt.q); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("numberedPinyin(%q) = %q, want %q", tt.q, got, tt.want)
+		}
+	}
+}
+
+// phraseField returns the field a query from pinyinQuery matches.
+func phraseField(q query.Query) string {
+	cq, ok := q.(*query.ConjunctionQuery)
+	if !ok || len(cq.Conjuncts) == 0 {
+		return ""
+	}
+	pq, ok := cq.Conjuncts[0].(*query.MatchPhraseQuery)
+	if !ok {
+		return ""
+	}
+	return pq.FieldVal
+}
+
+func TestPinyinQuery(t *testing.T) {
+	tests := []struct {
+		q     string
+		field string
+	}{
+		{"ni3 hao3", "pinyin_numbered"},
+		{"nǐ hǎo", "pinyin_numbered"},
+		{"ni hao", "pinyin_toneless"},
+		{"ni3 hao", "pinyin_toneless"},
+		{"ni3 5", "pinyin_numbered"},
+		{"shang4hai3", "pinyin_numbered"},
+		{"xiexie", "pinyin_toneless"},
+		{"chifan", "pinyin_toneless"},
+		{"5", ""},
+		{"儂", ""},
+	}
+
+	for _, tt := range tests {
+		got := pinyinQuery(tt.q, pinyinBoost)
+		if tt.field == "" {
+			if got != nil {
+				t.Errorf("pinyinQuery(%q) = %v, want nil", tt.q, got)
+			}
+			continue
+		}
+		if field := phraseField(got); field != tt.field {
+			t.Errorf("pinyinQuery(%q) matches %q, want %q", tt.q, field, tt.field)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+
+	"github.com/GitTsubasa/gumby/romanization"
+)
+
+// convertedReadingsFields returns the fields readings are indexed in for each romanization they're converted to.
+func convertedReadingsFields(suffix string) []string {
+	fields := make([]string, len(romanization.Converted))
+	for i, system := range romanization.Converted {
+		fields[i] = "definitions.readings_" + string(system) + suffix
+	}
+	return fields
+}
+
+// hasWildcards reports whether q uses * or ? wildcards.
+func hasWildcards(q string) bool {
+	return strings.ContainsAny(q, "*?")
+}
+
+// wildcardQuery matches q as a pattern against whole words and readings.
+func wildcardQuery(q string) query.Query {
+	return bleve.NewDisjunctionQuery(append(wordWildcardClauses(q), readingWildcardClauses(q)...)...)
+}
+
+func newWildcardQuery(q string, field string) query.Query {
+	wq := bleve.NewWildcardQuery(q)
+	wq.SetField(field)
+	return wq
+}
+
+// wordWildcardClauses match q as a pattern against whole words.
+func wordWildcardClauses(q string) []query.Query {
+	return []query.Query{newWildcardQuery(q, "word_exact"), newWildcardQuery(q, "simplified_exact")}
+}
+
+// readingWildcardClauses match q as a pattern against whole readings in any romanization.
+func readingWildcardClauses(q string) []query.Query {
+	var qs []query.Query
+	for _, field := range []string{"definitions.readings_exact", "definitions.readings_no_diacritics_exact"} {
+		qs = append(qs, newWildcardQuery(q, field))
+	}
+
+	for _, field := range convertedReadingsFields("_exact") {
+		qs = append(qs, newWildcardQuery(romanization.Normalize(q), field))
+	}
+
+	// Also match single syllables, so zau* finds every reading with a syllable starting with zau.
+	if !strings.ContainsRune(q, ' ') {
+		for _, field := range []string{"definitions.readings", "definitions.readings_no_diacritics"} {
+			qs = append(qs, newWildcardQuery(q, field))
+		}
+
+		for _, field := range convertedReadingsFields("") {
+			qs = append(qs, newWildcardQuery(romanization.Normalize(q), field))
+		}
+	}
+
+	return qs
+}
+
+// Boosts weigh where q matched, so that words and readings that are q outrank words and readings containing it, which
+// outrank meanings containing it. Mandarin readings are weighed least, since they're only there for those who know
+// Mandarin better.
+const (
+	exactWordBoost        = 10
+	exactReadingBoost     = 8
+	wordBoost             = 4
+	readingBoost          = 3
+	exactMeaningBoost     = 3
+	convertedReadingBoost = 2
+	meaningBoost          = 1
+	pinyinBoost           = 0.5
+)
+
+// boostedPhraseQuery matches q as a phrase in field. Bleve ignores the boosts of phrase queries, so the terms of the
+// phrase are matched again on their own to carry the boost.
+func boostedPhraseQuery(q string, field string, boost float64) query.Query {
+	pq := bleve.NewMatchPhraseQuery(q)
+	pq.SetField(field)
+
+	mq := bleve.NewMatchQuery(q)
+	mq.SetField(field)
+	mq.SetOperator(query.MatchQueryOperatorAnd)
+	mq.SetBoost(boost)
+
+	return bleve.NewConjunctionQuery(pq, mq)
+}
+
+// variantBoost weighs matches of forms of a query other than the query as typed, e.g. 喫 for 吃.
+const variantBoost = 0.5
+
+func newBoostedTermQuery(q string, field string, boost float64) query.Query {
+	tq := bleve.NewTermQuery(q)
+	tq.SetField(field)
+	tq.SetBoost(boost)
+	return tq
+}
+
+// wordClauses match q as a phrase in words, weighed by scale on top of their boosts.
+func wordClauses(q string, scale float64) []query.Query {
+	return []query.Query{
+		boostedPhraseQuery(q, "word", wordBoost*scale),
+		boostedPhraseQuery(q, "simplified", wordBoost*scale),
+		newBoostedTermQuery(q, "word_exact", exactWordBoost*scale),
+		newBoostedTermQuery(q, "simplified_exact", exactWordBoost*scale),
+	}
+}
+
+// readingClauses match q as a phrase in readings in any romanization, weighed by scale on top of their boosts.
+func readingClauses(q string, scale float64) []query.Query {
+	lower := strings.ToLower(q)
+	qs := []query.Query{
+		boostedPhraseQuery(q, "definitions.readings", readingBoost*scale),
+		boostedPhraseQuery(q, "definitions.readings_no_diacritics", readingBoost*scale),
+		newBoostedTermQuery(lower, "definitions.readings_exact", exactReadingBoost*scale),
+		newBoostedTermQuery(lower, "definitions.readings_no_diacritics_exact", exactReadingBoost*scale),
+	}
+
+	// Readings in other romanizations are indexed without tones, so drop any from the query.
+	normalized := romanization.Normalize(q)
+	for _, field := range convertedReadingsFields("") {
+		qs = append(qs,
+			boostedPhraseQuery(normalized, field, convertedReadingBoost*scale),
+			newBoostedTermQuery(normalized, field+"_exact", exactReadingBoost*scale))
+	}
+
+	return qs
+}
+
+// meaningClauses match q as a phrase in meanings, weighed by scale on top of their boosts.
+func meaningClauses(q string, scale float64) []query.Query {
+	return []query.Query{
+		boostedPhraseQuery(q, "definitions.meanings", meaningBoost*scale),
+		newBoostedTermQuery(strings.ToLower(q), "definitions.senses", exactMeaningBoost*scale),
+	}
+}
+
+// phraseQuery matches q as a phrase against words, readings in any romanization, Mandarin readings and meanings, and
+// against phrase templates it fills in. Every match is weighed by scale on top of its boost.
+func phraseQuery(q string, templates []*phraseTemplate, scale float64) query.Query {
+	var qs []query.Query
+	qs = append(qs, wordClauses(q, scale)...)
+	qs = append(qs, readingClauses(q, scale)...)
+	qs = append(qs, meaningClauses(q, scale)...)
+
+	if pq := pinyinQuery(q, pinyinBoost*scale); pq != nil {
+		qs = append(qs, pq)
+	}
+
+	if ids := matchTemplates(templates, q); len(ids) > 0 {
+		qs = append(qs, bleve.NewDocIDQuery(ids))
+	}
+
+	return bleve.NewDisjunctionQuery(qs...)
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// Advanced queries limit terms to fields with prefixes, e.g. word:上海 or meaning:"to give", exclude terms with -,
+// and combine terms with OR, grouped with parentheses. Terms next to each other must all match.
+
+// queryFields are the fields terms can be limited to.
+var queryFields = []string{"word", "reading", "meaning", "source"}
+
+// advancedQueryPattern matches queries that use any advanced syntax. Other queries are looked up as a single phrase.
+// Only the names of fields count as prefixes, so meanings like "note: tea" aren't taken for them.
+var advancedQueryPattern = regexp.MustCompile(`(^|\s)(OR(\s|$)|-\S|\(*(?i:` + strings.Join(queryFields, "|") + `):)|"`)
+
+// isAdvancedQuery reports whether q uses the advanced query syntax.
+func isAdvancedQuery(q string) bool {
+	return advancedQueryPattern.MatchString(q)
+}
+
+// queryError is a mistake in a query that's explained to the user.
+type queryError interface {
+	error
+	title() string
+	describe() string
+}
+
+// queryParseError is a mistake in an advanced query, at an offset in bytes into it.
+type queryParseError struct {
+	query   string
+	offset  int
+	message string
+
+	// unknownField is set if the mistake is a prefix that isn't a field, which may not have been meant as one.
+	unknownField bool
+}
+
+func (e *queryParseError) title() string {
+	return "Couldn't understand that query"
+}
+
+func (e *queryParseError) Error() string {
+	return fmt.Sprintf("column %d: %s", utf8.RuneCountInString(e.query[:e.offset])+1, e.message)
+}
+
+// describe explains the mistake and points it out in the query, for users.
+func (e *queryParseError) describe() string {
+	width := 0
+	for _, r := range e.query[:e.offset] {
+		// Wide characters take up two columns in code blocks.
+		if unicode.Is(unicode.Han, r) || unicode.In(r, unicode.Hangul, unicode.Hiragana, unicode.Katakana) {
+			width += 2
+		} else {
+			width++
+		}
+	}
+
+	return fmt.Sprintf("%s\n```\n%s\n%s^\n```", e.message, e.query, strings.Repeat(" ", width))
+}
+
+type queryTokenKind int
+
+const (
+	queryTokenTerm queryTokenKind = iota
+	queryTokenOr
+	queryTokenNot
+	queryTokenOpen
+	queryTokenClose
+)
+
+type queryToken struct {
+	kind   queryTokenKind
+	offset int
+
+	// field and text are the field prefix, if any, and the text of a term.
+	field string
+	text  string
+}
+
+// tokenizeQuery splits an advanced query into terms and operators.
+func tokenizeQuery(q string) ([]queryToken, error) {
+	fail := func(offset int, format string, args ...interface{}) ([]queryToken, error) {
+		return nil, &queryParseError{query: q, offset: offset, message: fmt.Sprintf(format, args...)}
+	}
+
+	var tokens []queryToken
+	for i := 0; i < len(q); {
+		r, size := utf8.DecodeRuneInString(q[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: queryTokenOpen, offset: i})
+			i += size
+
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: queryTokenClose, offset: i})
+			i += size
+
+		case r == '-':
+			next, _ := utf8.DecodeRuneInString(q[i+size:])
+			if i+size == len(q) || unicode.IsSpace(next) {
+				return fail(i, "Put “-” right before what to exclude, e.g. `-money`.")
+			}
+			tokens = append(tokens, queryToken{kind: queryTokenNot, offset: i})
+			i += size
+
+		default:
+			start := i
+
+			field := ""
+			if m := queryFieldPrefixPattern.FindStringSubmatch(q[i:]); m != nil {
+				field = strings.ToLower(m[1])
+				if !isQueryField(field) {
+					return nil, &queryParseError{
+						query:        q,
+						offset:       i,
+						message:      fmt.Sprintf("There's no field called “%s”. Use `word:`, `reading:`, `meaning:` or `source:`.", m[1]),
+						unknownField: true,
+					}
+				}
+				i += len(m[0])
+			}
+
+			var text string
+			if strings.HasPrefix(q[i:], `"`) {
+				end := strings.IndexByte(q[i+1:], '"')
+				if end < 0 {
+					return fail(i, "This quote is never closed. Add a closing `\"`.")
+				}
+				text = strings.TrimSpace(q[i+1 : i+1+end])
+				i += end + 2
+			} else {
+				end := strings.IndexFunc(q[i:], func(r rune) bool {
+					return unicode.IsSpace(r) || r == '(' || r == ')'
+				})
+				if end < 0 {
+					end = len(q) - i
+				}
+				text = q[i : i+end]
+				i += end
+			}
+
+			if text == "" {
+				if field != "" {
+					return fail(start, "Add something to search for after `%s:`.", field)
+				}
+				return fail(start, "These quotes are empty. Put what to search for in them.")
+			}
+
+			if field == "" && text == "OR" && q[start] != '"' {
+				tokens = append(tokens, queryToken{kind: queryTokenOr, offset: start})
+				continue
+			}
+
+			tokens = append(tokens, queryToken{kind: queryTokenTerm, offset: start, field: field, text: text})
+		}
+	}
+
+	return tokens, nil
+}
+
+// queryFieldPrefixPattern matches a field prefix at the start of a term, e.g. word:.
+var queryFieldPrefixPattern = regexp.MustCompile(`^([A-Za-z]+):`)
+
+func isQueryField(field string) bool {
+	for _, f := range queryFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+type queryNodeKind int
+
+const (
+	queryNodeTerm queryNodeKind = iota
+	queryNodeAnd
+	queryNodeOr
+	queryNodeNot
+)
+
+// queryNode is a parsed advanced query: a term, or an operator over other nodes.
+type queryNode struct {
+	kind   queryNodeKind
+	offset int
+
+	term     queryToken
+	children []*queryNode
+}
+
+// queryParser parses tokens into a tree of AND, OR and NOT nodes, with AND binding tighter than OR.
+type queryParser struct {
+	query  string
+	tokens []queryToken
+	pos    int
+
+	// depth is how many parentheses are open.
+	depth int
+}
+
+func (p *queryParser) fail(offset int, format string, args ...interface{}) error {
+	return &queryParseError{query: p.query, offset: offset, message: fmt.Sprintf(format, args...)}
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos == len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// endOffset is where the query ends, for mistakes at the end of it.
+func (p *queryParser) endOffset() int {
+	return len(strings.TrimRightFunc(p.query, unicode.IsSpace))
+}
+
+func (p *queryParser) parseOr() (*queryNode, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	node := &queryNode{kind: queryNodeOr, offset: first.offset, children: []*queryNode{first}}
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind != queryTokenOr {
+			break
+		}
+		p.pos++
+
+		next, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		node.children = append(node.children, next)
+	}
+
+	if len(node.children) == 1 {
+		return first, nil
+	}
+	return node, nil
+}
+
+func (p *queryParser) parseAnd() (*queryNode, error) {
+	node := &queryNode{kind: queryNodeAnd}
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind == queryTokenOr || t.kind == queryTokenClose {
+			break
+		}
+
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		node.children = append(node.children, child)
+	}
+
+	if len(node.children) == 0 {
+		t, ok := p.peek()
+		if ok && t.kind == queryTokenOr {
+			return nil, p.fail(t.offset, "“OR” needs something to search for on both sides.")
+		}
+		if p.pos > 0 && p.tokens[p.pos-1].kind == queryTokenOr {
+			return nil, p.fail(p.tokens[p.pos-1].offset, "“OR” needs something to search for on both sides.")
+		}
+		if ok && t.kind == queryTokenClose && p.depth == 0 {
+			return nil, p.fail(t.offset, "This parenthesis was never opened.")
+		}
+		if ok && t.kind == queryTokenClose {
+			return nil, p.fail(t.offset, "There's nothing to search for in these parentheses.")
+		}
+		return nil, p.fail(p.endOffset(), "There's nothing to search for.")
+	}
+
+	node.offset = node.children[0].offset
+	if len(node.children) == 1 {
+		return node.children[0], nil
+	}
+	return node, nil
+}
+
+func (p *queryParser) parseUnary() (*queryNode, error) {
+	t, _ := p.peek()
+	p.pos++
+
+	switch t.kind {
+	case queryTokenNot:
+		if next, ok := p.peek(); !ok || next.kind != queryTokenTerm && next.kind != queryTokenOpen {
+			return nil, p.fail(t.offset, "Put “-” right before what to exclude, e.g. `-money`.")
+		}
+
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &queryNode{kind: queryNodeNot, offset: t.offset, children: []*queryNode{child}}, nil
+
+	case queryTokenOpen:
+		p.depth++
+		child, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.depth--
+
+		if next, ok := p.peek(); !ok || next.kind != queryTokenClose {
+			return nil, p.fail(t.offset, "This parenthesis is never closed. Add a closing `)`.")
+		}
+		p.pos++
+		return child, nil
+
+	default:
+		return &queryNode{kind: queryNodeTerm, offset: t.offset, term: t}, nil
+	}
+}
+
+// parseQuery parses an advanced query.
+func parseQuery(q string) (*queryNode, error) {
+	tokens, err := tokenizeQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{query: q, tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t, ok := p.peek(); ok {
+		return nil, p.fail(t.offset, "This parenthesis was never opened.")
+	}
+	return node, nil
+}
+
+// buildQuery builds the bleve query for a parsed advanced query.
+func buildQuery(idx *loadedIndex, q string, node *queryNode) (query.Query, error) {
+	fail := func(offset int, format string, args ...interface{}) (query.Query, error) {
+		return nil, &queryParseError{query: q, offset: offset, message: fmt.Sprintf(format, args...)}
+	}
+
+	switch node.kind {
+	case queryNodeTerm:
+		return termQuery(idx, q, node.term)
+
+	case queryNodeOr:
+		var qs []query.Query
+		for _, child := range node.children {
+			cq, err := buildQuery(idx, q, child)
+			if err != nil {
+				return nil, err
+			}
+			qs = append(qs, cq)
+		}
+		return bleve.NewDisjunctionQuery(qs...), nil
+
+	case queryNodeAnd:
+		var musts, mustNots []query.Query
+		for _, child := range node.children {
+			if child.kind == queryNodeNot {
+				cq, err := buildQuery(idx, q, child.children[0])
+				if err != nil {
+					return nil, err
+				}
+				mustNots = append(mustNots, cq)
+				continue
+			}
+
+			cq, err := buildQuery(idx, q, child)
+			if err != nil {
+				return nil, err
+			}
+			musts = append(musts, cq)
+		}
+
+		if len(musts) == 0 {
+			return fail(node.offset, "“-” only excludes from other results. Add something to search for too.")
+		}
+
+		bq := bleve.NewBooleanQuery()
+		bq.AddMust(musts...)
+		bq.AddMustNot(mustNots...)
+		return bq, nil
+	}
+
+	// Exclusions on their own, e.g. -money, exclude from everything.
+	return fail(node.offset, "“-” only excludes from other results. Add something to search for too.")
+}
+
+// termQuery matches a single term of an advanced query, in its field if it has one.
+func termQuery(idx *loadedIndex, q string, t queryToken) (query.Query, error) {
+	switch t.field {
+	case "":
+		return lookupQuery(idx, queryVariants(t.text)), nil
+
+	case "word":
+		var qs []query.Query
+		for i, f := range queryVariants(t.text) {
+			scale := 1.0
+			if i > 0 {
+				scale = variantBoost
+			}
+
+			if hasWildcards(f) {
+				qs = append(qs, wordWildcardClauses(f)...)
+			} else {
+				qs = append(qs, wordClauses(f, scale)...)
+			}
+		}
+		return bleve.NewDisjunctionQuery(qs...), nil
+
+	case "reading":
+		if hasWildcards(t.text) {
+			return bleve.NewDisjunctionQuery(readingWildcardClauses(t.text)...), nil
+		}
+		return bleve.NewDisjunctionQuery(readingClauses(t.text, 1)...), nil
+
+	case "meaning":
+		if hasWildcards(t.text) {
+			if strings.ContainsRune(t.text, ' ') {
+				return nil, &queryParseError{query: q, offset: t.offset, message: "Wildcards in meanings only match single words, e.g. `meaning:giv*`."}
+			}
+			return newWildcardQuery(strings.ToLower(t.text), "definitions.meanings_terms"), nil
+		}
+		return bleve.NewDisjunctionQuery(meaningClauses(t.text, 1)...), nil
+
+	case "source":
+		var sources []string
+		for _, d := range idx.dictionaries {
+			if d.source == t.text || d.command == t.text {
+				tq := bleve.NewTermQuery(d.source)
+				tq.SetField("source")
+				return tq, nil
+			}
+			sources = append(sources, "`"+d.source+"`")
+		}
+		return nil, &queryParseError{query: q, offset: t.offset, message: fmt.Sprintf("There's no dictionary called “%s”. Try %s.", t.text, strings.Join(sources, ", "))}
+	}
+
+	return nil, &queryParseError{query: q, offset: t.offset, message: fmt.Sprintf("There's no field called “%s”.", t.field)}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIsAdvancedQuery(t *testing.T) {
+	tests := []struct {
+		q    string
+		want bool
+	}{
+		{"上海", false},
+		{"to give", false},
+		{"note: tea", false},
+		{"e.g: x", false},
+		{"co-op", false},
+		{"word:上海", true},
+		{"Meaning:tea", true},
+		{"(reading:nong OR word:儂)", true},
+		{"tea -milk", true},
+		{"tea OR coffee", true},
+		{"tea ORange", false},
+		{`"to give"`, true},
+	}
+
+	for _, tt := range tests {
+		if got := isAdvancedQuery(tt.q); got != tt.want {
+			t.Errorf("isAdvancedQuery(%q) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestTokenizeQuery(t *testing.T) {
+	tests := []struct {
+		q    string
+		want []queryToken
+	}{
+		{"", nil},
+		{"上海", []queryToken{{kind: queryTokenTerm, text: "上海"}}},
+		{`Word:上海 meaning:" to give "`, []queryToken{
+			{kind: queryTokenTerm, field: "word", text: "上海"},
+			{kind: queryTokenTerm, offset: 12, field: "meaning", text: "to give"},
+		}},
+		{"(a OR -b)", []queryToken{
+			{kind: queryTokenOpen},
+			{kind: queryTokenTerm, offset: 1, text: "a"},
+			{kind: queryTokenOr, offset: 3},
+			{kind: queryTokenNot, offset: 6},
+			{kind: queryTokenTerm, offset: 7, text: "b"},
+			{kind: queryTokenClose, offset: 8},
+		}},
+		{`"OR"`, []queryToken{{kind: queryTokenTerm, text: "OR"}}},
+	}
+
+	for _, tt := range tests {
+		got, err := tokenizeQuery(tt.q)
+		if err != nil {
+			t.Errorf("tokenizeQuery(%q) failed: %s", tt.q, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenizeQuery(%q) = %+v, want %+v", tt.q, got, tt.want)
+		}
+	}
+}
+
+// formatQueryNode writes node back out as a query, with every operator in parentheses.
+func formatQueryNode(node *queryNode) string {
+	var parts []string
+	for _, child := range node.children {
+		parts = append(parts, formatQueryNode(child))
+	}
+
+	switch node.kind {
+	case queryNodeTerm:
+		if node.term.field != "" {
+			return node.term.field + ":" + node.term.text
+		}
+		return node.term.text
+	case queryNodeAnd:
+		return "(" + strings.Join(parts, " AND ") + ")"
+	case queryNodeOr:
+		return "(" + strings.Join(parts, " OR ") + ")"
+	default:
+		return "-" + parts[0]
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		q    string
+		want string
+	}{
+		{"a", "a"},
+		{"a b", "(a AND b)"},
+		{"a OR b c", "(a OR (b AND c))"},
+		{"(a OR b) c", "((a OR b) AND c)"},
+		{"a -b", "(a AND -b)"},
+		{"a -(b OR c)", "(a AND -(b OR c))"},
+		{"((a))", "a"},
+		{`word:上海 OR reading:"zaon he"`, "(word:上海 OR reading:zaon he)"},
+	}
+
+	for _, tt := range tests {
+		node, err := parseQuery(tt.q)
+		if err != nil {
+			t.Errorf("parseQuery(%q) failed: %s", tt.q, err)
+			continue
+		}
+		if got := formatQueryNode(node); got != tt.want {
+			t.Errorf("parseQuery(%q) = %s, want %s", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		q            string
+		offset       int
+		unknownField bool
+	}{
+		{"a OR", 2, false},
+		{"OR a", 0, false},
+		{"a OR OR b", 5, false},
+		{"(a", 0, false},
+		{"a)", 1, false},
+		{"()", 1, false},
+		{"a - b", 2, false},
+		{`word:"上海`, 5, false},
+		{`""`, 0, false},
+		{"word:", 0, false},
+		{"word:上海 note: tea", 12, true},
+	}
+
+	for _, tt := range tests {
+		_, err := parseQuery(tt.q)
+
+		var pe *queryParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("parseQuery(%q) = %v, want a queryParseError", tt.q, err)
+			continue
+		}
+		if pe.offset != tt.offset || pe.unknownField != tt.unknownField {
+			t.Errorf("parseQuery(%q) failed at %d (unknown field %v), want %d (%v): %s", tt.q, pe.offset, pe.unknownField, tt.offset, tt.unknownField, pe.message)
+		}
+	}
+}
+
+func TestQueryParseErrorDescribe(t *testing.T) {
+	_, err := parseQuery("上海 OR")
+
+	var pe *queryParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("parseQuery() = %v, want a queryParseError", err)
+	}
+
+	// 上海 takes up four columns, so the caret is under OR.
+	want := "```\n上海 OR\n     ^\n```"
+	if got := pe.describe(); !strings.HasSuffix(got, want) {
+		t.Errorf("describe() = %q, want it to end with %q", got, want)
+	}
+}
+
+func TestLookupUnknownField(t *testing.T) {
+	b := newTestBot(t)
+
+	for _, q := range []string{"note: tea", "e.g: tea", "word:茶 note: tea"} {
+		if _, _, err := b.lookup(q, "", 10, 0); err != nil {
+			t.Errorf("lookup(%q) failed: %s", q, err)
+		}
+	}
+
+	if _, _, err := b.lookup("word:茶 OR", "", 10, 0); err == nil {
+		t.Errorf("lookup() of a query with a mistake succeeded")
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/GitTsubasa/gumby/romanization"
+)
+
+// kangxiRadicals are the 214 Kangxi radicals, in order.
+var kangxiRadicals = []rune("一丨丶丿乙亅二亠人儿入八冂冖冫几凵刀力勹匕匚匸十卜卩厂厶又口囗土士夂夊夕大女子宀寸小尢尸屮山巛工己巾干幺广廴廾弋弓彐彡彳心戈戶手支攴文斗斤方无日曰月木欠止歹殳毋比毛氏气水火爪父爻爿片牙牛犬玄玉瓜瓦甘生用田疋疒癶白皮皿目矛矢石示禸禾穴立竹米糸缶网羊羽老而耒耳聿肉臣自至臼舌舛舟艮色艸虍虫血行衣襾見角言谷豆豕豸貝赤走足身車辛辰辵邑酉釆里金長門阜隶隹雨靑非面革韋韭音頁風飛食首香馬骨高髟鬥鬯鬲鬼魚鳥鹵鹿麥麻黃黍黑黹黽鼎鼓鼠鼻齊齒龍龜龠")
+
+// radicalStrokeStarts are the numbers of the first radicals with 1, 2, 3... strokes.
+var radicalStrokeStarts = []int{1, 7, 30, 61, 95, 118, 147, 167, 176, 187, 195, 201, 205, 209, 211, 212, 214}
+
+// radicalForms maps the forms radicals take in characters, and their simplified forms, to radical numbers.
+var radicalForms = map[rune]int{
+	'亻': 9, '刂': 18, '忄': 61, '扌': 64, '攵': 66, '氵': 85, '灬': 86, '爫': 87, '犭': 94, '王': 96, '礻': 113,
+	'罒': 122, '艹': 140, '衤': 145, '西': 146, '辶': 162, '青': 174, '黄': 201,
+	'纟': 120, '见': 147, '讠': 149, '贝': 154, '车': 159, '钅': 167, '长': 168, '门': 169, '韦': 178, '页': 181,
+	'风': 182, '飞': 183, '饣': 184, '马': 187, '鱼': 195, '鸟': 196, '卤': 197, '麦': 199, '齐': 210, '齿': 211,
+	'龙': 212, '龟': 213,
+}
+
+const (
+	// maxRadicalStrokeTerms bounds how many radical-stroke counts are counted when browsing, which is more than any
+	// Unihan release has.
+	maxRadicalStrokeTerms = 20000
+
+	// maxSelectMenuRows bounds how many select menus of options a browse step takes, leaving a row for the step before.
+	maxSelectMenuRows = 4
+)
+
+const (
+	customIDPrefixRadicalStrokes  string = "radical:strokes"
+	customIDPrefixRadical         string = "radical:radical"
+	customIDPrefixResidualStrokes string = "radical:residual"
+)
+
+// radicalStrokeCount returns the number of strokes in radical n.
+func radicalStrokeCount(n int) int {
+	return sort.Search(len(radicalStrokeStarts), func(i int) bool { return radicalStrokeStarts[i] > n })
+}
+
+// radicalName returns radical n with its number, e.g. 口 (30).
+func radicalName(n int) string {
+	return fmt.Sprintf("%s (%d)", string(kangxiRadicals[n-1]), n)
+}
+
+// parseRadical returns the number of the radical s, which is a radical, one of its forms, or its number.
+func parseRadical(s string) (int, bool) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, n >= 1 && n <= len(kangxiRadicals)
+	}
+
+	runes := []rune(s)
+	if len(runes) != 1 {
+		return 0, false
+	}
+	r := runes[0]
+
+	// The Kangxi Radicals block has the radicals in order.
+	if r >= '⼀' && r <= '⿕' {
+		return int(r-'⼀') + 1, true
+	}
+
+	for i, kr := range kangxiRadicals {
+		if kr == r {
+			return i + 1, true
+		}
+	}
+
+	n, ok := radicalForms[r]
+	return n, ok
+}
+
+// parseRadicalStrokes splits a radical-stroke count into the radical number and the residual stroke count, e.g.
+// 30.13 -> 30, 13.
+func parseRadicalStrokes(q string) (int, int, bool) {
+	before, after, ok := strings.Cut(q, ".")
+	if !ok {
+		return 0, 0, false
+	}
+
+	radical, err := strconv.Atoi(before)
+	if err != nil || radical < 1 || radical > len(kangxiRadicals) {
+		return 0, 0, false
+	}
+
+	residual, err := strconv.Atoi(after)
+	if err != nil || residual < 0 {
+		return 0, 0, false
+	}
+
+	return radical, residual, true
+}
+
+// describeRadicalStrokes describes a radical-stroke count, e.g. 口 (30) + 13 strokes.
+func describeRadicalStrokes(q string) string {
+	radical, residual, ok := parseRadicalStrokes(q)
+	if !ok {
+		return q
+	}
+	return fmt.Sprintf("%s + %s", radicalName(radical), pluralize(residual, "stroke", "strokes"))
+}
+
+// pluralize counts n of something, e.g. 1 stroke or 2 strokes.
+func pluralize(n int, singular string, plural string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
+
+// radicalLookup finds the single characters with the radical-stroke count q.
+func (b *Bot) radicalLookup(q string, source string, limit int, offset int) ([]result, uint64, error) {
+	if _, _, ok := parseRadicalStrokes(q); !ok {
+		return nil, 0, nil
+	}
+
+	idx, release := b.acquireIndex()
+	defer release()
+
+	tq := bleve.NewTermQuery(q)
+	tq.SetField("radical_strokes")
+	return searchIndex(idx, tq, source, limit, offset)
+}
+
+// radicalCounts counts the entries of each radical and residual stroke count.
+func (b *Bot) radicalCounts() (map[int]map[int]int, error) {
+	idx, release := b.acquireIndex()
+	defer release()
+
+	req := bleve.NewSearchRequest(bleve.NewMatchAllQuery())
+	req.Size = 0
+	req.AddFacet("radical_strokes", bleve.NewFacetRequest("radical_strokes", maxRadicalStrokeTerms))
+
+	r, err := idx.Search(req)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int]map[int]int)
+	if facet, ok := r.Facets["radical_strokes"]; ok {
+		for _, t := range facet.Terms {
+			radical, residual, ok := parseRadicalStrokes(t.Term)
+			if !ok {
+				continue
+			}
+			if counts[radical] == nil {
+				counts[radical] = make(map[int]int)
+			}
+			counts[radical][residual] += t.Count
+		}
+	}
+
+	return counts, nil
+}
+
+// sumCounts adds up the entries of every residual stroke count of a radical.
+func sumCounts(counts map[int]int) int {
+	n := 0
+	for _, c := range counts {
+		n += c
+	}
+	return n
+}
+
+// makeSelectMenuRows splits options into select menus of 25, the most Discord allows in one.
+func makeSelectMenuRows(customIDPrefix string, system romanization.System, placeholder string, options []discordgo.SelectMenuOption) []discordgo.MessageComponent {
+	var rows []discordgo.MessageComponent
+	for i := 0; i < len(options) && len(rows) < maxSelectMenuRows; i += 25 {
+		end := min(i+25, len(options))
+
+		// Custom IDs have to be unique in a message, so number the menus.
+		rows = append(rows, discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					Placeholder: truncate(fmt.Sprintf("%s (%s to %s)", placeholder, options[i].Label, options[end-1].Label), 150, "..."),
+					Options:     options[i:end],
+					CustomID:    fmt.Sprintf("%s|%s:%d", customIDPrefix, system, len(rows)),
+				},
+			},
+		})
+	}
+	return rows
+}
+
+// makeRadicalStrokesMenu makes the menu of radical stroke counts, which starts browsing by radical.
+func makeRadicalStrokesMenu(counts map[int]map[int]int, system romanization.System) []discordgo.MessageComponent {
+	var options []discordgo.SelectMenuOption
+	for strokes := 1; strokes <= len(radicalStrokeStarts); strokes++ {
+		var radicals []string
+		for n := radicalStrokeStarts[strokes-1]; n <= len(kangxiRadicals) && radicalStrokeCount(n) == strokes; n++ {
+			if len(counts[n]) > 0 {
+				radicals = append(radicals, string(kangxiRadicals[n-1]))
+			}
+		}
+
+		if len(radicals) == 0 {
+			continue
+		}
+
+		options = append(options, discordgo.SelectMenuOption{
+			Label:       fmt.Sprintf("Radicals with %s", pluralize(strokes, "stroke", "strokes")),
+			Description: truncate(strings.Join(radicals, " "), 100, "..."),
+			Value:       strconv.Itoa(strokes),
+		})
+	}
+
+	if len(options) == 0 {
+		return nil
+	}
+
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					Placeholder: "Select the number of strokes in the radical",
+					Options:     options,
+					CustomID:    customIDPrefixRadicalStrokes + "|" + string(system),
+				},
+			},
+		},
+	}
+}
+
+// makeRadicalsResponse makes the menu of radicals with strokes strokes.
+func makeRadicalsResponse(counts map[int]map[int]int, strokes int, system romanization.System) *discordgo.InteractionResponseData {
+	var options []discordgo.SelectMenuOption
+	for n := 1; n <= len(kangxiRadicals); n++ {
+		if radicalStrokeCount(n) != strokes || len(counts[n]) == 0 {
+			continue
+		}
+
+		options = append(options, discordgo.SelectMenuOption{
+			Label:       radicalName(n),
+			Description: pluralize(sumCounts(counts[n]), "entry", "entries"),
+			Value:       strconv.Itoa(n),
+		})
+	}
+
+	components := makeRadicalStrokesMenu(counts, system)
+	components = append(components, makeSelectMenuRows(customIDPrefixRadical, system, "Select a radical", options)...)
+
+	return &discordgo.InteractionResponseData{
+		Content:    fmt.Sprintf("**Radicals with %s**", pluralize(strokes, "stroke", "strokes")),
+		Components: components,
+	}
+}
+
+// makeResidualStrokesResponse makes the menu of residual stroke counts of the characters with radical.
+func makeResidualStrokesResponse(counts map[int]map[int]int, radical int, system romanization.System) *discordgo.InteractionResponseData {
+	residuals := make([]int, 0, len(counts[radical]))
+	for residual := range counts[radical] {
+		residuals = append(residuals, residual)
+	}
+	sort.Ints(residuals)
+
+	options := make([]discordgo.SelectMenuOption, len(residuals))
+	for i, residual := range residuals {
+		options[i] = discordgo.SelectMenuOption{
+			Label:       fmt.Sprintf("%s + %s", string(kangxiRadicals[radical-1]), pluralize(residual, "stroke", "strokes")),
+			Description: pluralize(counts[radical][residual], "entry", "entries"),
+			Value:       fmt.Sprintf("%d.%d", radical, residual),
+		}
+	}
+
+	data := &discordgo.InteractionResponseData{
+		Content:    fmt.Sprintf("**Characters under %s**", radicalName(radical)),
+		Components: makeRadicalStrokesMenu(counts, system),
+	}
+
+	if len(options) == 0 {
+		data.Embeds = []*discordgo.MessageEmbed{
+			{
+				Color:       0x4B5563,
+				Description: "No characters under this radical yet.",
+			},
+		}
+		return data
+	}
+
+	data.Components = append(data.Components, makeSelectMenuRows(customIDPrefixResidualStrokes, system, "Select the number of strokes besides the radical", options)...)
+	return data
+}
+
+// HandleRadical starts browsing characters by radical, or skips to the given radical.
+func (b *Bot) HandleRadical(i *discordgo.InteractionCreate) {
+	system := romanization.Church
+	var radicalOption string
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "radical":
+			radicalOption = strings.TrimSpace(option.StringValue())
+		case "romanization":
+			system = parseRomanization(option.StringValue())
+		}
+	}
+
+	counts, err := b.radicalCounts()
+	if err != nil {
+		b.respond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Embeds: []*discordgo.MessageEmbed{
+					{
+						Color:       0xDC2626,
+						Description: "An error occurred.",
+					},
+				},
+			},
+		})
+		log.Printf("Failed to count radicals: %s", err)
+		return
+	}
+
+	var data *discordgo.InteractionResponseData
+	if radicalOption == "" {
+		data = &discordgo.InteractionResponseData{
+			Content:    "**Browse by radical**",
+			Components: makeRadicalStrokesMenu(counts, system),
+		}
+		if len(data.Components) == 0 {
+			data.Embeds = []*discordgo.MessageEmbed{
+				{
+					Color:       0x4B5563,
+					Description: "No characters can be browsed by radical yet.",
+				},
+			}
+		}
+	} else if radical, ok := parseRadical(radicalOption); ok {
+		data = makeResidualStrokesResponse(counts, radical, system)
+	} else {
+		data = &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Color:       0xDC2626,
+					Description: fmt.Sprintf("“%s” isn't a Kangxi radical. Try a radical like 口, or its number like 30.", radicalOption),
+				},
+			},
+		}
+	}
+
+	if err := b.respond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	}); err != nil {
+		log.Printf("Failed to send interaction: %s", err)
+		return
+	}
+}
+
+// handleRadicalInteraction moves to the next step of browsing by radical, from the option picked in a select menu.
+func (b *Bot) handleRadicalInteraction(i *discordgo.InteractionCreate, prefix string, rawPayload string) {
+	// The payload is the romanization, followed by the number of the menu if there's more than one.
+	systemName, _, _ := strings.Cut(rawPayload, ":")
+	system := parseRomanization(systemName)
+	value := i.Interaction.MessageComponentData().Values[0]
+
+	var data *discordgo.InteractionResponseData
+	if prefix == customIDPrefixResidualStrokes {
+		var err error
+		data, err = b.makeShdefResponse(shdefActionGoToPage{Query: value, Romanization: system, Mode: searchModeRadical})
+		if err != nil {
+			log.Printf("Failed to find characters: %s", err)
+			return
+		}
+	} else {
+		counts, err := b.radicalCounts()
+		if err != nil {
+			log.Printf("Failed to count radicals: %s", err)
+			return
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			log.Printf("Failed to parse %s: %s", prefix, err)
+			return
+		}
+
+		if prefix == customIDPrefixRadicalStrokes {
+			data = makeRadicalsResponse(counts, n, system)
+		} else {
+			data = makeResidualStrokesResponse(counts, n, system)
+		}
+	}
+
+	b.updateMessage(i, data)
+}
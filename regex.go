@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+const (
+	// maxRegexLength bounds how long a pattern can be.
+	maxRegexLength = 100
+
+	// regexTimeout bounds how long a pattern is searched for, leaving time to answer within the 3 seconds Discord waits.
+	regexTimeout = 2 * time.Second
+)
+
+// regexFields are the fields patterns are matched against: whole words, whole readings and single syllables.
+var regexFields = []string{"word_exact", "simplified_exact", "definitions.readings_exact", "definitions.readings"}
+
+// invalidPatternError is a pattern that isn't a valid regular expression.
+type invalidPatternError struct {
+	err error
+}
+
+func (e *invalidPatternError) Error() string {
+	return e.err.Error()
+}
+
+func (e *invalidPatternError) title() string {
+	return "That isn't a valid regular expression"
+}
+
+func (e *invalidPatternError) describe() string {
+	return fmt.Sprintf("```\n%s\n```", e.err)
+}
+
+// slowPatternError is a pattern that took too long to search for.
+type slowPatternError struct{}
+
+func (e *slowPatternError) Error() string {
+	return "pattern took too long to search for"
+}
+
+func (e *slowPatternError) title() string {
+	return "That pattern took too long to search for"
+}
+
+func (e *slowPatternError) describe() string {
+	return "Try a more specific pattern, e.g. one that starts with the letters it matches."
+}
+
+// compileRegex checks that q is a valid pattern, returning it without anchors, since it always matches whole terms,
+// and compiled as it's matched.
+func compileRegex(q string) (string, *regexp.Regexp, error) {
+	if len(q) > maxRegexLength {
+		return "", nil, &invalidPatternError{fmt.Errorf("patterns can be at most %d characters long", maxRegexLength)}
+	}
+
+	pattern := strings.TrimPrefix(q, "^")
+	if strings.HasSuffix(pattern, "$") && !strings.HasSuffix(pattern, `\$`) {
+		pattern = strings.TrimSuffix(pattern, "$")
+	}
+
+	if _, err := regexp.Compile(pattern); err != nil {
+		return "", nil, &invalidPatternError{err}
+	}
+	return pattern, regexp.MustCompile("^(?:" + pattern + ")$"), nil
+}
+
+// regexLookup finds the entries with a word, reading or syllable that the regular expression q matches in full. It
+// matches against the terms in the index where it can, and scans every entry for patterns the index can't match.
+func (b *Bot) regexLookup(q string, source string, limit int, offset int) ([]result, uint64, error) {
+	pattern, re, err := compileRegex(q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), regexTimeout)
+	defer cancel()
+
+	idx, release := b.acquireIndex()
+	defer release()
+
+	var qs []query.Query
+	for _, field := range regexFields {
+		rq := bleve.NewRegexpQuery(pattern)
+		rq.SetField(field)
+		qs = append(qs, rq)
+	}
+
+	results, count, err := searchRegex(ctx, idx, bleve.NewDisjunctionQuery(qs...), source, limit, offset)
+	if err == nil || ctx.Err() != nil {
+		return results, count, err
+	}
+	log.Printf("Failed to match %q against the index, scanning instead: %s", q, err)
+
+	ids, err := scanRegex(ctx, idx, re, source)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(ids) == 0 {
+		return nil, 0, nil
+	}
+
+	return searchRegex(ctx, idx, bleve.NewDocIDQuery(ids), source, limit, offset)
+}
+
+// searchRegex finds the entries matching a pattern. How many terms of an entry match says nothing about how well it
+// matches, so entries are ordered as if they matched equally well.
+func searchRegex(ctx context.Context, idx *loadedIndex, textMatch query.Query, source string, limit int, offset int) ([]result, uint64, error) {
+	req := newSearchRequest(textMatch, source, limit, offset)
+	req.SortBy([]string{"word_length", "homograph", "_id"})
+
+	results, count, err := searchResults(ctx, idx, req)
+	if ctx.Err() != nil {
+		return nil, 0, &slowPatternError{}
+	}
+	return results, count, err
+}
+
+// scanRegex finds the entries with a word, reading or syllable that re matches, by checking every entry in source.
+func scanRegex(ctx context.Context, idx *loadedIndex, re *regexp.Regexp, source string) ([]string, error) {
+	count, err := idx.DocCount()
+	if err != nil {
+		return nil, err
+	}
+
+	req := newSearchRequest(bleve.NewMatchAllQuery(), source, int(count), 0)
+	req.Fields = []string{"word", "simplified", "definitions.readings"}
+	req.SortBy([]string{"_id"})
+
+	r, err := idx.SearchInContext(ctx, req)
+	if ctx.Err() != nil {
+		return nil, &slowPatternError{}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for i, hit := range r.Hits {
+		if i%1000 == 0 && ctx.Err() != nil {
+			return nil, &slowPatternError{}
+		}
+
+		terms := append(fieldToStringList(hit.Fields["word"]), fieldToStringList(hit.Fields["simplified"])...)
+		for _, reading := range fieldToStringList(hit.Fields["definitions.readings"]) {
+			terms = append(terms, reading)
+			terms = append(terms, strings.Fields(reading)...)
+		}
+
+		for _, t := range terms {
+			if re.MatchString(t) {
+				ids = append(ids, hit.ID)
+				break
+			}
+		}
+	}
+
+	return ids, nil
+}
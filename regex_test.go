@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCompileRegex(t *testing.T) {
+	tests := []struct {
+		q       string
+		pattern string
+		matches []string
+		misses  []string
+	}{
+		{"z.*", "z.*", []string{"zaon", "z"}, []string{"nong", "az"}},
+		{"^zaon$", "zaon", []string{"zaon"}, []string{"zaonhe", "a zaon"}},
+		{"a|nong", "a|nong", []string{"a", "nong"}, []string{"anong", "nonga"}},
+		{`.*\$`, `.*\$`, []string{"cost$"}, []string{"cost"}},
+		{"[^aeiou]+ng", "[^aeiou]+ng", []string{"tsng", "hng"}, []string{"ng", "nong"}},
+	}
+
+	for _, tt := range tests {
+		pattern, re, err := compileRegex(tt.q)
+		if err != nil {
+			t.Errorf("compileRegex(%q) failed: %s", tt.q, err)
+			continue
+		}
+		if pattern != tt.pattern {
+			t.Errorf("compileRegex(%q) = %q, want %q", tt.q, pattern, tt.pattern)
+		}
+
+		// Patterns always match whole terms.
+		for _, s := range tt.matches {
+			if !re.MatchString(s) {
+				t.Errorf("compileRegex(%q) doesn't match %q", tt.q, s)
+			}
+		}
+		for _, s := range tt.misses {
+			if re.MatchString(s) {
+				t.Errorf("compileRegex(%q) matches %q", tt.q, s)
+			}
+		}
+	}
+}
+
+func TestCompileRegexLimits(t *testing.T) {
+	tests := []struct {
+		q   string
+		err string
+	}{
+		{strings.Repeat("a", maxRegexLength), ""},
+		{strings.Repeat("a", maxRegexLength+1), "at most 100 characters"},
+		{"(zaon", "missing closing )"},
+		{"*", "missing argument"},
+		{`\1`, "invalid escape"},
+		// Go's regexps run in linear time, so patterns that backtrack badly elsewhere are fine.
+		{"(a+)+b", ""},
+	}
+
+	for _, tt := range tests {
+		_, _, err := compileRegex(tt.q)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("compileRegex(%q) failed: %s", tt.q, err)
+			}
+			continue
+		}
+
+		var ie *invalidPatternError
+		if !errors.As(err, &ie) || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("compileRegex(%q) = %v, want an invalidPatternError containing %q", tt.q, err, tt.err)
+		}
+	}
+}
+
+func TestRegexLookup(t *testing.T) {
+	b := newTestBot(t)
+
+	results, count, err := b.regexLookup("zong h.e t.an", "", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rankOf(results, "上海灘") == 0 {
+		t.Errorf("regexLookup(%q) found %d results without 上海灘", "zong h.e t.an", count)
+	}
+
+	if _, _, err := b.regexLookup("(", "", 10, 0); err == nil {
+		t.Errorf("regexLookup() of an invalid pattern succeeded")
+	}
+}
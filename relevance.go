@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/bwmarrin/discordgo"
+)
+
+// weightPattern matches the explanation of the weight of a term in a field, e.g. weight(word_exact:人^10.000000 in …).
+var weightPattern = regexp.MustCompile(`^weight\(([\w.]+):`)
+
+// fieldWeights sums how much each field contributed to expl, before coordination.
+func fieldWeights(expl *search.Explanation, weights map[string]float64) {
+	if expl == nil {
+		return
+	}
+
+	if m := weightPattern.FindStringSubmatch(expl.Message); m != nil {
+		weights[m[1]] += expl.Value
+		return
+	}
+
+	for _, child := range expl.Children {
+		fieldWeights(child, weights)
+	}
+}
+
+// explainLookup scores the results of a lookup, with an explanation of each score.
+func (b *Bot) explainLookup(q string, source string, limit int, offset int) (search.DocumentMatchCollection, error) {
+	idx, release := b.acquireIndex()
+	defer release()
+
+	textMatch, _, err := textMatchQuery(idx, strings.TrimSpace(q))
+	if err != nil {
+		return nil, err
+	}
+
+	req := newSearchRequest(textMatch, source, limit, offset)
+	req.Fields = []string{"word"}
+	req.Explain = true
+
+	r, err := idx.Search(req)
+	if err != nil {
+		return nil, err
+	}
+	return r.Hits, nil
+}
+
+// makeRankingOutput explains how the page of results for s was ranked, by the score of each result and the fields
+// that contributed to it.
+func (b *Bot) makeRankingOutput(s shdefActionGoToPage) (*discordgo.MessageEmbed, error) {
+	hits, err := b.explainLookup(s.Query, s.source(), queryLimit, s.Page*queryLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for i, hit := range hits {
+		weights := make(map[string]float64)
+		fieldWeights(hit.Expl, weights)
+
+		fields := make([]string, 0, len(weights))
+		for field := range weights {
+			fields = append(fields, field)
+		}
+		sort.Slice(fields, func(i int, j int) bool {
+			return weights[fields[i]] > weights[fields[j]]
+		})
+
+		for j, field := range fields {
+			fields[j] = fmt.Sprintf("%s %.3f", field, weights[field])
+		}
+
+		word, _ := hit.Fields["word"].(string)
+		lines = append(lines, fmt.Sprintf("%d. **%s** %.4f: %s", s.Page*queryLimit+i+1, word, hit.Score, strings.Join(fields, ", ")))
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       "Ranking",
+		Color:       0x4B5563,
+		Description: truncate(strings.Join(lines, "\n"), 4096, "..."),
+	}, nil
+}
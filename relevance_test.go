@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// relevanceCasesPath is the relevance test set: a query, the word expected for it and how many of the top results it
+// should be within, separated by tabs.
+const relevanceCasesPath = "dictionaries/relevance.tsv"
+
+// minMeanReciprocalRank is the mean reciprocal rank of the expected words that lookups have reached. Raise it along
+// with changes that rank them better, so that later changes can't silently rank them worse.
+const minMeanReciprocalRank = 0.84
+
+// relevanceCase is a query and a word that should be among its top results.
+type relevanceCase struct {
+	line     int
+	query    string
+	expected string
+	within   int
+}
+
+func loadRelevanceCases(path string) ([]relevanceCase, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cases []relevanceCase
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected a query, a word and a rank", path, lineNum)
+		}
+
+		within, err := strconv.Atoi(fields[2])
+		if err != nil || within < 1 {
+			return nil, fmt.Errorf("%s:%d: invalid rank %q", path, lineNum, fields[2])
+		}
+
+		cases = append(cases, relevanceCase{line: lineNum, query: fields[0], expected: fields[1], within: within})
+	}
+
+	return cases, scanner.Err()
+}
+
+// rankOf returns the 1-based rank of the first result spelled word, or 0 if there is none.
+func rankOf(results []result, word string) int {
+	for i, r := range results {
+		if r.word == word {
+			return i + 1
+		}
+		for _, s := range r.simplified {
+			if s == word {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+// TestRelevance checks the ranking of lookups against the relevance test set. Pass the debug option to a lookup to see
+// which fields each result's score came from.
+func TestRelevance(t *testing.T) {
+	b := newTestBot(t)
+
+	cases, err := loadRelevanceCases(relevanceCasesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Look further than any case needs, so misses still count towards the mean reciprocal rank.
+	const depth = 100
+
+	reciprocalRanks := 0.0
+	for _, rc := range cases {
+		results, _, err := b.lookup(rc.query, "", depth, 0)
+		if err != nil {
+			t.Fatalf("Failed to look up %q: %s", rc.query, err)
+		}
+
+		rank := rankOf(results, rc.expected)
+		if rank > 0 {
+			reciprocalRanks += 1 / float64(rank)
+		}
+
+		if rank == 0 || rank > rc.within {
+			var top []string
+			for _, r := range results[:min(len(results), rc.within)] {
+				top = append(top, r.word)
+			}
+			t.Errorf("%s:%d: %q ranked %s at %d, want within %d (top: %s)", relevanceCasesPath, rc.line, rc.query, rc.expected, rank, rc.within, strings.Join(top, " "))
+		}
+	}
+
+	mrr := reciprocalRanks / float64(max(len(cases), 1))
+	t.Logf("Mean reciprocal rank %.3f over %d cases", mrr, len(cases))
+	if mrr < minMeanReciprocalRank {
+		t.Errorf("Mean reciprocal rank %.3f, want at least %.3f", mrr, minMeanReciprocalRank)
+	}
+}
+
+// TestBestMatch checks which lookups show their first result on its own, as the word being looked up.
+func TestBestMatch(t *testing.T) {
+	b := newTestBot(t)
+
+	tests := []struct {
+		q    string
+		want bool
+	}{
+		{"上海", true},
+		{"阿拉", true},
+		{"ah la", true},
+		{"謝謝", true},
+		{"儂", false},
+		{"you", false},
+		{"to eat", false},
+	}
+
+	for _, tt := range tests {
+		s := shdefActionGoToPage{Query: tt.q}
+		results, _, err := b.search(s, 2, 0)
+		if err != nil {
+			t.Fatalf("Failed to look up %q: %s", tt.q, err)
+		}
+
+		if got := hasBestMatch(s, results); got != tt.want {
+			t.Errorf("hasBestMatch(%q) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+// Package romanization converts readings from the church romanization used in the dictionaries to other systems.
+//
+// Readings are converted to their modern pronunciation, e.g. sing becomes ɕiŋ, since that is what learners type. The
+// dictionaries don't mark tones, so no system has them either, and Normalize strips them from queries.
+package romanization
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// System is a way of writing readings.
+type System string
+
+const (
+	// Church is the missionary romanization the dictionaries are written in, e.g. nyih t'in.
+	Church System = "church"
+	// Wugniu is the romanization used by Wugniu (吳語學堂), e.g. gnih thin.
+	Wugniu System = "wugniu"
+	// Qian is Qian Nairong's Shanghainese pinyin, e.g. nyiq thin.
+	Qian System = "qian"
+	// IPA is the International Phonetic Alphabet, e.g. ȵiɪʔ tʰin.
+	IPA System = "ipa"
+)
+
+// Converted are the systems church romanization can be converted to.
+var Converted = []System{Wugniu, Qian, IPA}
+
+var names = map[System]string{
+	Church: "Church romanization",
+	Wugniu: "Wugniu",
+	Qian:   "Qian Nairong",
+	IPA:    "IPA",
+}
+
+// Name returns the name of s to show to users.
+func (s System) Name() string {
+	if name, ok := names[s]; ok {
+		return name
+	}
+	return string(s)
+}
+
+// Parse returns the system called s, or false if there is none.
+func Parse(s string) (System, bool) {
+	if _, ok := names[System(s)]; !ok {
+		return "", false
+	}
+	return System(s), true
+}
+
+// spelling is how a sound is written in each converted system.
+type spelling struct {
+	ipa    string
+	wugniu string
+	qian   string
+}
+
+func (sp spelling) in(s System) string {
+	switch s {
+	case Wugniu:
+		return sp.wugniu
+	case Qian:
+		return sp.qian
+	default:
+		return sp.ipa
+	}
+}
+
+type initial struct {
+	spelling
+
+	// zero initials are written by their rime in Wugniu and Qian, and yang zero initials start with ɦ.
+	zero bool
+	yang bool
+
+	// medial is the glide the initial implies, e.g. i for ky.
+	medial string
+}
+
+var initials = map[string]initial{
+	"p":   {spelling: spelling{"p", "p", "p"}},
+	"p'":  {spelling: spelling{"pʰ", "ph", "ph"}},
+	"b":   {spelling: spelling{"b", "b", "b"}},
+	"m":   {spelling: spelling{"m", "m", "m"}},
+	"m'":  {spelling: spelling{"ʔm", "m", "m"}},
+	"f":   {spelling: spelling{"f", "f", "f"}},
+	"v":   {spelling: spelling{"v", "v", "v"}},
+	"t":   {spelling: spelling{"t", "t", "t"}},
+	"t'":  {spelling: spelling{"tʰ", "th", "th"}},
+	"d":   {spelling: spelling{"d", "d", "d"}},
+	"n":   {spelling: spelling{"n", "n", "n"}},
+	"n'":  {spelling: spelling{"ʔn", "n", "n"}},
+	"l":   {spelling: spelling{"l", "l", "l"}},
+	"l'":  {spelling: spelling{"ʔl", "l", "l"}},
+	"ts":  {spelling: spelling{"ts", "ts", "ts"}},
+	"ts'": {spelling: spelling{"tsʰ", "tsh", "tsh"}},
+	"tsh": {spelling: spelling{"tsʰ", "tsh", "tsh"}},
+	"s":   {spelling: spelling{"s", "s", "s"}},
+	"z":   {spelling: spelling{"z", "z", "z"}},
+	"ds":  {spelling: spelling{"z", "z", "z"}},
+	"k":   {spelling: spelling{"k", "k", "k"}},
+	"k'":  {spelling: spelling{"kʰ", "kh", "kh"}},
+	"g":   {spelling: spelling{"g", "g", "g"}},
+	"ng":  {spelling: spelling{"ŋ", "ng", "ng"}},
+	"h'":  {spelling: spelling{"h", "h", "h"}},
+	"kw":  {spelling: spelling{"k", "k", "k"}, medial: "u"},
+	"kw'": {spelling: spelling{"kʰ", "kh", "kh"}, medial: "u"},
+	"gw":  {spelling: spelling{"g", "g", "g"}, medial: "u"},
+	"hw":  {spelling: spelling{"h", "h", "h"}, medial: "u"},
+	"ky":  {spelling: spelling{"tɕ", "c", "j"}, medial: "i"},
+	"ky'": {spelling: spelling{"tɕʰ", "ch", "q"}, medial: "i"},
+	"gy":  {spelling: spelling{"dʑ", "j", "jh"}, medial: "i"},
+	"ny":  {spelling: spelling{"ȵ", "gn", "ny"}, medial: "i"},
+	"ny'": {spelling: spelling{"ʔȵ", "gn", "ny"}, medial: "i"},
+	"hy":  {spelling: spelling{"ɕ", "sh", "x"}, medial: "i"},
+	"hy'": {spelling: spelling{"ɕ", "sh", "x"}, medial: "i"},
+
+	// dj is a rarer spelling of gy, e.g. djeh.
+	"dj": {spelling: spelling{"dʑ", "j", "jh"}, medial: "i"},
+
+	// zy isn't written in church romanization, but is what z and ds have palatalized to, e.g. zin 盡 is now ʑin.
+	"zy": {spelling: spelling{"ʑ", "zh", "xh"}, medial: "i"},
+
+	// Without an apostrophe, h, y and w are voiced, e.g. hú 户, yeu 有, we 位.
+	"":   {zero: true},
+	"h":  {zero: true, yang: true},
+	"y":  {zero: true, yang: true, medial: "i"},
+	"y'": {zero: true, medial: "i"},
+	"w":  {zero: true, yang: true, medial: "u"},
+	"w'": {zero: true, medial: "u"},
+}
+
+// palatalized are the sibilants that have since palatalized before i and ü, e.g. sing 心 is now ɕiŋ.
+var palatalized = map[string]string{
+	"s":   "hy",
+	"ts":  "ky",
+	"ts'": "ky'",
+	"tsh": "ky'",
+	"z":   "zy",
+	"ds":  "zy",
+}
+
+var rimes = map[string]spelling{
+	"a":    {"a", "a", "a"},
+	"á":    {"a", "a", "a"},
+	"e":    {"e", "e", "e"},
+	"i":    {"i", "i", "i"},
+	"u":    {"u", "u", "u"},
+	"ú":    {"u", "u", "u"},
+	"o":    {"o", "o", "o"},
+	"ó":    {"o", "o", "o"},
+	"au":   {"ɔ", "au", "ao"},
+	"eu":   {"ɤ", "eu", "eu"},
+	"ü":    {"y", "iu", "yu"},
+	"üi":   {"y", "iu", "yu"},
+	"z":    {"ɿ", "y", "y"},
+	"û":    {"ʮ", "y", "y"},
+	"an":   {"ɛ", "e", "e"},
+	"en":   {"ø", "oe", "oe"},
+	"ön":   {"ø", "oe", "oe"},
+	"öi":   {"ø", "oe", "oe"},
+	"öen":  {"ø", "oe", "oe"},
+	"ón":   {"ø", "oe", "oe"},
+	"ung":  {"əŋ", "en", "en"},
+	"un":   {"əŋ", "en", "en"},
+	"úng":  {"oŋ", "on", "ong"},
+	"ong":  {"ɑ̃", "aon", "aon"},
+	"ang":  {"ã", "an", "aan"},
+	"áng":  {"ã", "an", "aan"},
+	"in":   {"in", "in", "in"},
+	"ing":  {"iŋ", "in", "in"},
+	"ün":   {"yn", "iun", "yun"},
+	"ah":   {"aʔ", "ah", "aq"},
+	"áh":   {"aʔ", "ah", "aq"},
+	"eh":   {"əʔ", "eh", "eq"},
+	"uh":   {"əʔ", "eh", "eq"},
+	"oh":   {"oʔ", "oh", "oq"},
+	"óh":   {"oʔ", "oh", "oq"},
+	"öh":   {"øʔ", "oeh", "oeq"},
+	"ih":   {"iɪʔ", "ih", "iq"},
+	"ia":   {"ia", "ia", "ia"},
+	"iá":   {"ia", "ia", "ia"},
+	"ie":   {"ie", "ie", "ie"},
+	"iau":  {"iɔ", "iau", "iao"},
+	"ieu":  {"iɤ", "ieu", "ieu"},
+	"ian":  {"iɛ", "ie", "ie"},
+	"iön":  {"yø", "ioe", "ioe"},
+	"iöh":  {"yøʔ", "ioeh", "ioeq"},
+	"iang": {"iã", "ian", "iaan"},
+	"iáng": {"iã", "ian", "iaan"},
+	"iong": {"iɑ̃", "iaon", "iaon"},
+	"iung": {"iŋ", "in", "in"},
+	"iun":  {"iŋ", "in", "in"},
+	"iú":   {"y", "iu", "yu"},
+	"iúng": {"ioŋ", "ion", "iong"},
+	"iah":  {"iaʔ", "iah", "iaq"},
+	"iáh":  {"iaʔ", "iah", "iaq"},
+	"ieh":  {"iɪʔ", "ih", "iq"},
+	"iuh":  {"iɪʔ", "ih", "iq"},
+	"ioh":  {"ioʔ", "ioh", "ioq"},
+	"ióh":  {"ioʔ", "ioh", "ioq"},
+	"ue":   {"ue", "ue", "ue"},
+	"ua":   {"ua", "ua", "ua"},
+	"uá":   {"ua", "ua", "ua"},
+	"uan":  {"uɛ", "ue", "ue"},
+	"uen":  {"uø", "uoe", "uoe"},
+	"uön":  {"uø", "uoe", "uoe"},
+	"uöi":  {"ue", "ue", "ue"},
+	"uung": {"uəŋ", "uen", "uen"},
+	"uun":  {"uəŋ", "uen", "uen"},
+	"uong": {"uɑ̃", "uaon", "uaon"},
+	"uáng": {"uã", "uan", "uaan"},
+	"uah":  {"uaʔ", "uah", "uaq"},
+	"uáh":  {"uaʔ", "uah", "uaq"},
+	"ueh":  {"uəʔ", "ueh", "ueq"},
+}
+
+// syllabics are syllables that are a lone consonant.
+var syllabics = map[string]spelling{
+	"m":   {"m̩", "m", "m"},
+	"m'":  {"ʔm̩", "m", "m"},
+	"n":   {"n̩", "n", "n"},
+	"n'":  {"ʔn̩", "n", "n"},
+	"ng":  {"ŋ̍", "ng", "ng"},
+	"ng'": {"ʔŋ̍", "ng", "ng"},
+	"rh":  {"əl", "er", "er"},
+}
+
+// maxInitialLen is the length of the longest initial, in bytes.
+const maxInitialLen = 3
+
+// Convert converts a reading in church romanization to s. Anything that isn't a syllable, like spaces and
+// placeholders, is kept as is, and so are syllables that can't be converted.
+func Convert(reading string, s System) string {
+	if s == Church {
+		return reading
+	}
+
+	var sb strings.Builder
+	start := -1
+	for i, r := range reading {
+		if isSyllableRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+
+		if start >= 0 {
+			sb.WriteString(convertSyllable(reading[start:i], s))
+			start = -1
+		}
+		sb.WriteRune(r)
+	}
+
+	if start >= 0 {
+		sb.WriteString(convertSyllable(reading[start:], s))
+	}
+
+	return sb.String()
+}
+
+func isSyllableRune(r rune) bool {
+	return unicode.IsLetter(r) || r == '\''
+}
+
+func convertSyllable(syllable string, s System) string {
+	lower := strings.ToLower(syllable)
+
+	if sp, ok := syllabics[lower]; ok {
+		return sp.in(s)
+	}
+
+	// Try the longest initial first, e.g. ts' before ts.
+	for n := min(maxInitialLen, len(lower)); n >= 0; n-- {
+		init, ok := initials[lower[:n]]
+		if !ok {
+			continue
+		}
+
+		if out, ok := spell(lower[:n], init, lower[n:], s); ok {
+			return out
+		}
+	}
+
+	return syllable
+}
+
+// spell writes the syllable made of the initial named name and the final in s.
+func spell(name string, init initial, final string, s System) (string, bool) {
+	rime := withMedial(init.medial, final)
+
+	if p, ok := palatalized[name]; ok && (strings.HasPrefix(rime, "i") || strings.HasPrefix(rime, "ü")) {
+		init = initials[p]
+	}
+
+	sp, ok := rimes[rime]
+	if !ok {
+		return "", false
+	}
+
+	if !init.zero {
+		return init.in(s) + sp.in(s), true
+	}
+
+	return spellZero(sp, init.yang, s), true
+}
+
+// withMedial joins the medial implied by an initial to the final after it, unless the final already starts with it.
+func withMedial(medial string, final string) string {
+	switch medial {
+	case "i":
+		if strings.HasPrefix(final, "i") || strings.HasPrefix(final, "ü") {
+			return final
+		}
+	case "u":
+		// u has since been lost before rounded vowels, e.g. hwó 花 is now ho.
+		if final == "u" || strings.HasPrefix(final, "ú") || strings.HasPrefix(final, "ó") || strings.HasPrefix(final, "o") {
+			return final
+		}
+	}
+	return medial + final
+}
+
+// spellZero writes a syllable with no initial consonant. Wugniu and Qian write the ɦ of yang syllables as y, w or gh.
+func spellZero(sp spelling, yang bool, s System) string {
+	rime := sp.in(s)
+	if !yang {
+		return rime
+	}
+
+	switch s {
+	case Wugniu:
+		switch {
+		case rime == "i" || rime == "in" || rime == "ih":
+			return "y" + rime
+		case strings.HasPrefix(rime, "i"):
+			return "y" + rime[1:]
+		case rime == "u":
+			return "wu"
+		case strings.HasPrefix(rime, "u"):
+			return "w" + rime[1:]
+		}
+		return "gh" + rime
+	case Qian:
+		switch {
+		case strings.HasPrefix(rime, "i"):
+			return "yh" + rime
+		case strings.HasPrefix(rime, "y") && rime != "y":
+			return "yh" + rime[1:]
+		case strings.HasPrefix(rime, "u"):
+			return "wh" + rime
+		}
+		return "gh" + rime
+	default:
+		return "ɦ" + rime
+	}
+}
+
+// tones are tone numbers and letters after a syllable, e.g. zaon6 or zɑ̃˨˧.
+var tones = regexp.MustCompile(`([\p{L}\p{M}'])[0-9⁰¹²³⁴⁵⁶⁷⁸⁹˥˦˧˨˩]+`)
+
+// Normalize prepares a query typed in any system for matching against converted readings, by lowercasing it and
+// removing tones.
+func Normalize(q string) string {
+	return tones.ReplaceAllString(strings.ToLower(q), "$1")
+}
@@ -0,0 +1,81 @@
+package romanization
+
+import "testing"
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		church string
+		wugniu string
+		qian   string
+		ipa    string
+	}{
+		{"nyih t'in", "gnih thin", "nyiq thin", "ȵiɪʔ tʰin"},
+		{"sing", "shin", "xin", "ɕiŋ"},
+		{"ts'ing", "chin", "qin", "tɕʰiŋ"},
+		{"kyi", "ci", "ji", "tɕi"},
+		{"zong h'e", "zaon he", "zaon he", "zɑ̃ he"},
+		{"ah la", "ah la", "aq la", "aʔ la"},
+		{"vah", "vah", "vaq", "vaʔ"},
+		{"yau", "yau", "yhiao", "ɦiɔ"},
+		{"hwó", "ho", "ho", "ho"},
+		{"ng", "ng", "ng", "ŋ̍"},
+		{"m", "m", "m", "m̩"},
+		{"NONG", "naon", "naon", "nɑ̃"},
+		{"kwun", "kuen", "kuen", "kuəŋ"},
+		{"hyú", "shiu", "xyu", "ɕy"},
+		{"k'ón", "khoe", "khoe", "kʰø"},
+		{"djeh", "jih", "jhiq", "dʑiɪʔ"},
+		{"hy'úng", "shion", "xiong", "ɕioŋ"},
+		{"köen", "koe", "koe", "kø"},
+		{"ts'üi", "chiu", "qyu", "tɕʰy"},
+		// Anything that isn't a syllable, and syllables that can't be converted, are kept as is.
+		{"…", "…", "…", "…"},
+		{"nong … la", "naon … la", "naon … la", "nɑ̃ … la"},
+		{"xyz", "xyz", "xyz", "xyz"},
+		{"", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		for s, want := range map[System]string{Church: tt.church, Wugniu: tt.wugniu, Qian: tt.qian, IPA: tt.ipa} {
+			if got := Convert(tt.church, s); got != want {
+				t.Errorf("Convert(%q, %s) = %q, want %q", tt.church, s, got, want)
+			}
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		q    string
+		want string
+	}{
+		{"zaon he", "zaon he"},
+		{"Zaon6 He5", "zaon he"},
+		{"zɑ̃˨˧ he˧˦", "zɑ̃ he"},
+		{"nyiq⁵ thin¹", "nyiq thin"},
+		{"t'in1", "t'in"},
+		// Numbers on their own aren't tones.
+		{"1 2", "1 2"},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.q); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, s := range append([]System{Church}, Converted...) {
+		if got, ok := Parse(string(s)); !ok || got != s {
+			t.Errorf("Parse(%q) = %q, %v, want %q", s, got, ok, s)
+		}
+		if _, ok := names[s]; !ok {
+			t.Errorf("%q has no name", s)
+		}
+	}
+
+	if _, ok := Parse("pinyin"); ok {
+		t.Errorf("Parse(%q) succeeded", "pinyin")
+	}
+}
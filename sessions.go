@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// sessionBucket is the bbolt bucket sessions are persisted in.
+var sessionBucket = []byte("sessions")
+
+// sessionTokenPattern matches the tokens sessions are stored under.
+var sessionTokenPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{12}$`)
+
+// sessionStore holds session payloads by token until they expire.
+type sessionStore interface {
+	// put stores payloads by token until expires, all at once.
+	put(payloads map[string][]byte, expires time.Time) error
+	get(token string, now time.Time) ([]byte, bool, error)
+
+	// sweep removes every session that expired before now.
+	sweep(now time.Time) error
+
+	Close() error
+}
+
+// sessions stores the state of searches on the server, so the components of their messages only need to carry a token
+// for it rather than the state itself, which can be longer than Discord allows custom IDs to be.
+type sessions struct {
+	store sessionStore
+	ttl   time.Duration
+}
+
+// openSessions keeps sessions in memory, or persists them in a bbolt database at path if given.
+func openSessions(path string, ttl time.Duration) (*sessions, error) {
+	if path == "" {
+		return &sessions{store: &memorySessionStore{sessions: make(map[string]memorySession)}, ttl: ttl}, nil
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(sessionBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sessions{store: &boltSessionStore{db: db}, ttl: ttl}, nil
+}
+
+// save stores v and returns its token. The token is derived from v, so saving the same state again refreshes it
+// rather than storing it twice.
+func (s *sessions) save(v interface{}) (string, error) {
+	tokens, err := s.saveAll(v)
+	if err != nil {
+		return "", err
+	}
+	return tokens[0], nil
+}
+
+// saveAll stores every v in a single write and returns their tokens, in order.
+func (s *sessions) saveAll(vs ...interface{}) ([]string, error) {
+	tokens := make([]string, len(vs))
+	payloads := make(map[string][]byte, len(vs))
+	for i, v := range vs {
+		payload, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(payload)
+		tokens[i] = base64.RawURLEncoding.EncodeToString(sum[:9])
+		payloads[tokens[i]] = payload
+	}
+
+	if err := s.store.put(payloads, time.Now().Add(s.ttl)); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// load loads the state stored under token into v, reporting false if it has expired or never existed.
+func (s *sessions) load(token string, v interface{}) (bool, error) {
+	if !sessionTokenPattern.MatchString(token) {
+		return false, nil
+	}
+
+	payload, ok, err := s.store.get(token, time.Now())
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if err := json.Unmarshal(payload, v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// expireEvery removes expired sessions every interval.
+func (s *sessions) expireEvery(interval time.Duration) {
+	for now := range time.Tick(interval) {
+		if err := s.store.sweep(now); err != nil {
+			log.Printf("Failed to expire sessions: %s", err)
+		}
+	}
+}
+
+type memorySession struct {
+	payload []byte
+	expires time.Time
+}
+
+type memorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]memorySession
+}
+
+func (m *memorySessionStore) put(payloads map[string][]byte, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for token, payload := range payloads {
+		m.sessions[token] = memorySession{payload: payload, expires: expires}
+	}
+	return nil
+}
+
+func (m *memorySessionStore) get(token string, now time.Time) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[token]
+	if !ok || now.After(session.expires) {
+		return nil, false, nil
+	}
+	return session.payload, true, nil
+}
+
+func (m *memorySessionStore) sweep(now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for token, session := range m.sessions {
+		if now.After(session.expires) {
+			delete(m.sessions, token)
+		}
+	}
+	return nil
+}
+
+func (m *memorySessionStore) Close() error {
+	return nil
+}
+
+// boltSessionStore persists sessions as their expiry time in Unix seconds followed by the payload.
+type boltSessionStore struct {
+	db *bolt.DB
+}
+
+func (b *boltSessionStore) put(payloads map[string][]byte, expires time.Time) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sessionBucket)
+		for token, payload := range payloads {
+			v := make([]byte, 8+len(payload))
+			binary.BigEndian.PutUint64(v, uint64(expires.Unix()))
+			copy(v[8:], payload)
+
+			if err := bucket.Put([]byte(token), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltSessionStore) get(token string, now time.Time) ([]byte, bool, error) {
+	var payload []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(sessionBucket).Get([]byte(token))
+		if len(v) < 8 || now.Unix() > int64(binary.BigEndian.Uint64(v)) {
+			return nil
+		}
+
+		// Values are only valid during the transaction.
+		payload = append([]byte{}, v[8:]...)
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return payload, payload != nil, nil
+}
+
+func (b *boltSessionStore) sweep(now time.Time) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sessionBucket)
+
+		// Deleting while iterating with a cursor skips keys, so find them all first.
+		var expired [][]byte
+		if err := bucket.ForEach(func(k []byte, v []byte) error {
+			if len(v) < 8 || now.Unix() > int64(binary.BigEndian.Uint64(v)) {
+				expired = append(expired, append([]byte{}, k...))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltSessionStore) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func testSessionStores(t *testing.T) map[string]*sessions {
+	t.Helper()
+
+	memory, err := openSessions("", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { memory.store.Close() })
+
+	bolt, err := openSessions(filepath.Join(t.TempDir(), "sessions.db"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bolt.store.Close() })
+
+	return map[string]*sessions{"memory": memory, "bolt": bolt}
+}
+
+func TestSessionsSaveLoad(t *testing.T) {
+	for name, s := range testSessionStores(t) {
+		want := shdefActionGoToPage{Query: "儂", Source: "dict", Romanization: "church"}
+
+		token, err := s.save(want)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if !sessionTokenPattern.MatchString(token) {
+			t.Errorf("%s: token %q doesn't match %s", name, token, sessionTokenPattern)
+		}
+
+		again, err := s.save(want)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if again != token {
+			t.Errorf("%s: saving the same state again gave token %q, want %q", name, again, token)
+		}
+
+		var got shdefActionGoToPage
+		ok, err := s.load(token, &got)
+		if err != nil || !ok || got != want {
+			t.Errorf("%s: load(%q) = %+v, %v, %v, want %+v", name, token, got, ok, err, want)
+		}
+
+		for _, token := range []string{"", "AAAAAAAAAAAA", "not a token", token + "x"} {
+			if ok, err := s.load(token, &got); ok || err != nil {
+				t.Errorf("%s: load(%q) = %v, %v, want false", name, token, ok, err)
+			}
+		}
+	}
+}
+
+func TestSessionsSaveAll(t *testing.T) {
+	for name, s := range testSessionStores(t) {
+		searches := []interface{}{
+			shdefActionGoToPage{Query: "a"},
+			shdefActionGoToPage{Query: "b"},
+			shdefActionGoToPage{Query: "a"},
+		}
+
+		tokens, err := s.saveAll(searches...)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if len(tokens) != 3 || tokens[0] == tokens[1] || tokens[0] != tokens[2] {
+			t.Fatalf("%s: got tokens %q, want one per distinct search, in order", name, tokens)
+		}
+
+		for i, token := range tokens {
+			var got shdefActionGoToPage
+			if ok, err := s.load(token, &got); !ok || err != nil || got != searches[i] {
+				t.Errorf("%s: load(%q) = %+v, %v, %v, want %+v", name, token, got, ok, err, searches[i])
+			}
+		}
+	}
+}
+
+func TestSessionsExpire(t *testing.T) {
+	for name, s := range testSessionStores(t) {
+		s.ttl = -time.Minute
+		expired, err := s.save(shdefActionGoToPage{Query: "expired"})
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		s.ttl = time.Hour
+		live, err := s.save(shdefActionGoToPage{Query: "live"})
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		var got shdefActionGoToPage
+		if ok, _ := s.load(expired, &got); ok {
+			t.Errorf("%s: loaded an expired session", name)
+		}
+
+		if err := s.store.sweep(time.Now()); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if _, ok, _ := s.store.get(expired, time.Now().Add(-time.Hour)); ok {
+			t.Errorf("%s: sweeping kept an expired session", name)
+		}
+		if ok, _ := s.load(live, &got); !ok {
+			t.Errorf("%s: sweeping removed a live session", name)
+		}
+	}
+}
+
+// countingSessionStore counts the writes to a session store.
+type countingSessionStore struct {
+	sessionStore
+	puts int
+}
+
+func (c *countingSessionStore) put(payloads map[string][]byte, expires time.Time) error {
+	c.puts++
+	return c.sessionStore.put(payloads, expires)
+}
+
+// customIDs returns the custom IDs of the components in rows.
+func customIDs(rows []discordgo.MessageComponent) []string {
+	var ids []string
+	for _, row := range rows {
+		for _, c := range row.(discordgo.ActionsRow).Components {
+			switch c := c.(type) {
+			case discordgo.Button:
+				ids = append(ids, c.CustomID)
+			case discordgo.SelectMenu:
+				ids = append(ids, c.CustomID)
+			}
+		}
+	}
+	return ids
+}
+
+func TestSearchSavesOneSession(t *testing.T) {
+	b := newTestBot(t)
+	store := &countingSessionStore{sessionStore: b.sessions.store}
+	b.sessions.store = store
+
+	s := shdefActionGoToPage{Query: "上海", Romanization: "church"}
+	data, err := b.makeShdefResponse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.puts != 1 {
+		t.Errorf("showing the first page wrote %d times, want 1", store.puts)
+	}
+
+	ids := customIDs(data.Components)
+	token, err := b.saveSearch(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		customIDPrefixShdefSelect + "|church|" + token + "|0",
+		customIDPrefixShdefGoToPage + "|" + token + "|1",
+	} {
+		if !strings.Contains(strings.Join(ids, "\n"), want) {
+			t.Errorf("got custom IDs %q, want one of them to be %q", ids, want)
+		}
+	}
+
+	store.puts = 0
+	s.Page = 1
+	if _, err := b.makePageOutput(s); err != nil {
+		t.Fatal(err)
+	}
+	if store.puts != 1 {
+		t.Errorf("showing the next page wrote %d times, want 1", store.puts)
+	}
+}
+
+func TestParsePagePayload(t *testing.T) {
+	tests := []struct {
+		payload string
+		token   string
+		page    int
+		ok      bool
+	}{
+		{pagePayload("AAAAAAAAAAAA", 3), "AAAAAAAAAAAA", 3, true},
+		{"AAAAAAAAAAAA|0", "AAAAAAAAAAAA", 0, true},
+		{"AAAAAAAAAAAA", "", 0, false},
+		{"AAAAAAAAAAAA|", "", 0, false},
+		{"AAAAAAAAAAAA|-1", "", 0, false},
+		{"AAAAAAAAAAAA|x", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		token, page, ok := parsePagePayload(tt.payload)
+		if token != tt.token || page != tt.page || ok != tt.ok {
+			t.Errorf("parsePagePayload(%q) = %q, %d, %v, want %q, %d, %v", tt.payload, token, page, ok, tt.token, tt.page, tt.ok)
+		}
+	}
+}
+
+func TestLoadPage(t *testing.T) {
+	s := testSessionStores(t)["memory"]
+	b := &Bot{sessions: s}
+
+	want := shdefActionGoToPage{Query: "上海", Romanization: "wugniu"}
+	token, err := s.save(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want.Page = 2
+	if got, ok := b.loadPage(nil, pagePayload(token, 2)); !ok || got != want {
+		t.Errorf("loadPage() = %+v, %v, want %+v", got, ok, want)
+	}
+
+	// Page buttons posted before searches were kept in sessions hold the search itself.
+	legacy := shdefActionGoToPage{Query: "上海", Source: "dict", Page: 1}
+	if got, ok := b.loadPage(nil, `{"query":"上海","source":"dict","page":1}`); !ok || got != legacy {
+		t.Errorf("loadPage() of a search = %+v, %v, want %+v", got, ok, legacy)
+	}
+
+	if _, ok := b.loadPage(nil, token); ok {
+		t.Errorf("loadPage() of a token without a page succeeded")
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 
 	"github.com/blevesearch/bleve/v2"
@@ -11,6 +14,8 @@ import (
 	index "github.com/blevesearch/bleve_index_api"
 	"github.com/bwmarrin/discordgo"
 
+	"github.com/GitTsubasa/gumby/romanization"
+
 	_ "github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
 	_ "github.com/blevesearch/bleve/v2/analysis/lang/en"
 	_ "github.com/blevesearch/bleve/v2/analysis/token/lowercase"
@@ -20,36 +25,129 @@ import (
 )
 
 type shdefActionGoToPage struct {
-	Query  string `json:"query"`
-	Source string `json:"source"`
-	Page   int    `json:"page"`
+	Query        string              `json:"query"`
+	Source       string              `json:"source"`
+	Page         int                 `json:"page"`
+	Romanization romanization.System `json:"romanization,omitempty"`
+	Mode         searchMode          `json:"mode,omitempty"`
+
+	// Debug explains how results were ranked.
+	Debug bool `json:"debug,omitempty"`
+
+	// Filter narrows a search of every dictionary down to the dictionary with this source.
+	Filter string `json:"filter,omitempty"`
+}
+
+// source returns the source of the dictionary s searches, or "" if it searches every dictionary.
+func (s shdefActionGoToPage) source() string {
+	if s.Source == "" {
+		return s.Filter
+	}
+	return s.Source
+}
+
+// searchMode is how a query is matched against entries.
+type searchMode string
+
+const (
+	// searchModeDefault matches words, readings and meanings.
+	searchModeDefault searchMode = ""
+	// searchModeComponent matches characters made of the components in the query.
+	searchModeComponent searchMode = "component"
+	// searchModeRadical matches single characters with the radical-stroke count in the query, e.g. 30.13.
+	searchModeRadical searchMode = "radical"
+	// searchModeRegex matches words, readings and syllables with the regular expression in the query.
+	searchModeRegex searchMode = "regex"
+)
+
+// search finds the entries matching s in its mode.
+func (b *Bot) search(s shdefActionGoToPage, limit int, offset int) ([]result, uint64, error) {
+	switch s.Mode {
+	case searchModeComponent:
+		return b.componentLookup(s.Query, s.source(), limit, offset)
+	case searchModeRadical:
+		return b.radicalLookup(s.Query, s.source(), limit, offset)
+	case searchModeRegex:
+		return b.regexLookup(s.Query, s.source(), limit, offset)
+	default:
+		return b.lookup(s.Query, s.source(), limit, offset)
+	}
+}
+
+// describe describes what s searches for, for result titles.
+func (s shdefActionGoToPage) describe() string {
+	switch s.Mode {
+	case searchModeComponent:
+		return fmt.Sprintf("characters with “%s”", s.Query)
+	case searchModeRadical:
+		return describeRadicalStrokes(s.Query)
+	case searchModeRegex:
+		return fmt.Sprintf("`%s`", s.Query)
+	default:
+		return fmt.Sprintf("“%s”", s.Query)
+	}
+}
+
+// parseRomanization returns the romanization called s, defaulting to the church romanization the dictionaries use.
+func parseRomanization(s string) romanization.System {
+	if system, ok := romanization.Parse(s); ok {
+		return system
+	}
+	return romanization.Church
 }
 
 const (
 	customIDPrefixShdefGoToPage string = "shdef:goToPage"
 	customIDPrefixShdefSelect   string = "shdef:select"
+	customIDPrefixShdefSearch   string = "shdef:search"
+	customIDPrefixShdefBack     string = "shdef:back"
+	customIDPrefixShdefNarrow   string = "shdef:narrow"
+	customIDPrefixShdefMerged   string = "shdef:merged"
 )
 
 type entry struct {
 	word        string
+	homograph   int
 	source      string
 	simplified  []string
+	pinyin      []string
 	definitions []definition
 }
 
+var superscriptDigits = strings.NewReplacer(
+	"0", "⁰", "1", "¹", "2", "²", "3", "³", "4", "⁴",
+	"5", "⁵", "6", "⁶", "7", "⁷", "8", "⁸", "9", "⁹",
+)
+
+// displayWord returns the word with its homograph number as a superscript, e.g. 一¹.
+func (e entry) displayWord() string {
+	if e.homograph == 0 {
+		return e.word
+	}
+	return e.word + superscriptDigits.Replace(strconv.Itoa(e.homograph))
+}
+
 type definition struct {
 	readings []string
 	meanings []string
 }
 
 func (b *Bot) findEntries(ids []string) (map[string]entry, error) {
+	idx, release := b.acquireIndex()
+	defer release()
+
 	entries := make(map[string]entry)
 	for _, id := range ids {
-		doc, err := b.index.Document(id)
+		doc, err := idx.Document(id)
 		if err != nil {
 			return nil, err
 		}
 
+		// The entry may be gone if the index was reloaded since it was found.
+		if doc == nil {
+			continue
+		}
+
 		var e entry
 		doc.VisitFields(func(f index.Field) {
 			arrayPositions := f.ArrayPositions()
@@ -59,6 +157,8 @@ func (b *Bot) findEntries(ids []string) (map[string]entry, error) {
 				e.word = string(f.Value())
 			case "simplified":
 				e.simplified = append(e.simplified, string(f.Value()))
+			case "pinyin":
+				e.pinyin = append(e.pinyin, string(f.Value()))
 			case "definitions.meanings":
 				for len(e.definitions) <= int(arrayPositions[0]) {
 					e.definitions = append(e.definitions, definition{})
@@ -75,6 +175,12 @@ func (b *Bot) findEntries(ids []string) (map[string]entry, error) {
 				for len(e.definitions) <= int(arrayPositions[0]) {
 					e.definitions = append(e.definitions, definition{})
 				}
+			case "homograph":
+				if nf, ok := f.(index.NumericField); ok {
+					if n, err := nf.Number(); err == nil {
+						e.homograph = int(n)
+					}
+				}
 			case "source":
 				e.source = string(f.Value())
 			}
@@ -89,83 +195,255 @@ func (b *Bot) findEntries(ids []string) (map[string]entry, error) {
 func (b *Bot) HandleComponentInteraction(i *discordgo.InteractionCreate) {
 	customID := i.Interaction.MessageComponentData().CustomID
 
-	pipeIndex := strings.IndexRune(customID, '|')
-	prefix := customID[:pipeIndex]
-	rawPayload := []byte(customID[pipeIndex+1:])
+	prefix, rawPayload, ok := strings.Cut(customID, "|")
+	if !ok {
+		log.Printf("Malformed custom ID: %q", customID)
+		return
+	}
 
 	switch prefix {
 	case customIDPrefixShdefGoToPage:
-		var payload shdefActionGoToPage
-		if err := json.Unmarshal(rawPayload, &payload); err != nil {
-			log.Printf("Failed to unmarshal payload words: %s", err)
+		payload, ok := b.loadPage(i, rawPayload)
+		if !ok {
 			return
 		}
 
-		results, count, err := b.lookup(payload.Query, payload.Source, queryLimit+1, payload.Page*queryLimit)
+		payload.Romanization = parseRomanization(string(payload.Romanization))
+		searchOutput, err := b.makePageOutput(payload)
 		if err != nil {
 			log.Printf("Failed to find words: %s", err)
 			return
 		}
 
-		hasNext := false
-		if len(results) > queryLimit {
-			results = results[:queryLimit]
-			hasNext = true
+		// Pages after the first keep the entry shown with the first, along with its button to compare dictionaries.
+		embeds := i.Message.Embeds
+		components := *searchOutput.Components
+		if searchOutput.Embeds != nil {
+			embeds = *searchOutput.Embeds
+		} else {
+			components = append(components, mergedButtonRows(i.Message.Components)...)
 		}
 
-		resultIDs := make([]string, len(results))
-		for i, r := range results {
-			resultIDs[i] = r.id
-		}
+		b.updateMessage(i, &discordgo.InteractionResponseData{
+			Content:    *searchOutput.Content,
+			Embeds:     embeds,
+			Components: components,
+		})
 
-		entries, err := b.findEntries(resultIDs)
-		if err != nil {
-			log.Printf("Failed to find entries: %s", err)
+	case customIDPrefixShdefBack:
+		payload, ok := b.loadPage(i, rawPayload)
+		if !ok {
 			return
 		}
 
-		searchOutput, err := makeSearchOutput(payload.Query, payload.Source, count, resultIDs, entries, payload.Page, hasNext)
+		payload.Romanization = parseRomanization(string(payload.Romanization))
+		data, err := b.makeResultsResponse(payload)
 		if err != nil {
-			log.Printf("Failed to make search output: %s", err)
+			log.Printf("Failed to find words: %s", err)
 			return
 		}
 
-		if err := b.discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate}); err != nil {
-			log.Printf("Failed to respond: %s", err)
+		b.updateMessage(i, data)
+
+	case customIDPrefixShdefSearch:
+		payload, ok := b.loadSearch(i, rawPayload)
+		if !ok {
 			return
 		}
 
-		if _, err := b.discord.InteractionResponseEdit(i.Interaction, searchOutput); err != nil {
-			log.Printf("Failed to edit response: %s", err)
+		payload.Romanization = parseRomanization(string(payload.Romanization))
+		data, err := b.makeShdefResponse(payload)
+		if err != nil {
+			log.Printf("Failed to find words: %s", err)
 			return
 		}
 
+		b.updateMessage(i, data)
+
+	case customIDPrefixRadicalStrokes, customIDPrefixRadical, customIDPrefixResidualStrokes:
+		b.handleRadicalInteraction(i, prefix, rawPayload)
+
 	case customIDPrefixShdefSelect:
-		word := i.Interaction.MessageComponentData().Values[0]
+		b.handleSelect(i, rawPayload)
 
-		entries, err := b.findEntries([]string{word})
-		if err != nil {
-			log.Printf("Failed to get entries: %s", err)
-			return
-		}
+	case customIDPrefixShdefNarrow:
+		b.handleNarrow(i, rawPayload)
+
+	case customIDPrefixShdefMerged:
+		b.handleMerged(i, rawPayload)
+	}
+}
+
+// handleSelect shows the entries selected from a menu, side by side if there are several. Menus of search results
+// carry the search after the romanization, so that the entries can be left to go back to the results.
+func (b *Bot) handleSelect(i *discordgo.InteractionCreate, rawPayload string) {
+	rawSystem, rawSearch, fromSearch := strings.Cut(rawPayload, "|")
+	system := parseRomanization(rawSystem)
+
+	ids := i.Interaction.MessageComponentData().Values
+	entries, err := b.findEntries(ids)
+	if err != nil {
+		log.Printf("Failed to get entries: %s", err)
+		return
+	}
 
-		entry, ok := entries[word]
+	var embeds []*discordgo.MessageEmbed
+	for _, id := range ids {
+		entry, ok := entries[id]
 		if !ok {
-			log.Printf("Failed to get entry")
-			return
+			log.Printf("Failed to get entry %s", id)
+			continue
 		}
+		embeds = append(embeds, b.makeEntryOutput(entry, system))
+	}
+	embeds = fitEmbeds(embeds)
 
-		if err := b.discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate}); err != nil {
-			log.Printf("Failed to respond: %s", err)
-			return
+	if len(embeds) == 0 {
+		log.Printf("Failed to get entry")
+		return
+	}
+
+	if !fromSearch {
+		b.updateMessage(i, &discordgo.InteractionResponseData{
+			Content:    i.Message.Content,
+			Embeds:     embeds,
+			Components: i.Message.Components,
+		})
+		return
+	}
+
+	content := ""
+	if len(embeds) > 1 {
+		content = fmt.Sprintf("**Comparing %d entries**", len(embeds))
+	}
+
+	buttons := []discordgo.MessageComponent{
+		discordgo.Button{
+			Emoji:    &discordgo.ComponentEmoji{Name: "↩️"},
+			Label:    "Back to results",
+			Style:    discordgo.SecondaryButton,
+			CustomID: customIDPrefixShdefBack + "|" + rawSearch,
+		},
+	}
+	if token, page, ok := parsePagePayload(rawSearch); ok && len(ids) == 1 {
+		if entry, ok := entries[ids[0]]; ok {
+			button, ok, err := b.makeMergedButton(entry, ids[0], token, page)
+			if err != nil {
+				log.Printf("Failed to find entries in other dictionaries: %s", err)
+			} else if ok {
+				buttons = append(buttons, button)
+			}
 		}
+	}
 
-		if _, err := b.discord.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-			Embeds: &[]*discordgo.MessageEmbed{makeEntryOutput(entry)},
-		}); err != nil {
-			log.Printf("Failed to edit response: %s", err)
-			return
+	b.updateMessage(i, &discordgo.InteractionResponseData{
+		Content: content,
+		Embeds:  embeds,
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: buttons},
+		},
+	})
+}
+
+// saveSearch keeps s in a session and returns its token. Every page of a search shares its session, so components
+// carry the page to show after the token.
+func (b *Bot) saveSearch(s shdefActionGoToPage) (string, error) {
+	s.Page = 0
+	return b.sessions.save(s)
+}
+
+// pagePayload is the payload of a component showing page of the search kept under token.
+func pagePayload(token string, page int) string {
+	return token + "|" + strconv.Itoa(page)
+}
+
+// parsePagePayload splits a payload made by pagePayload into its token and page.
+func parsePagePayload(rawPayload string) (string, int, bool) {
+	token, rawPage, ok := strings.Cut(rawPayload, "|")
+	if !ok {
+		return "", 0, false
+	}
+
+	page, err := strconv.Atoi(rawPage)
+	if err != nil || page < 0 {
+		return "", 0, false
+	}
+	return token, page, true
+}
+
+// loadSearch loads the search kept in the session with token. If the session has expired, it tells the user to
+// search again.
+func (b *Bot) loadSearch(i *discordgo.InteractionCreate, token string) (shdefActionGoToPage, bool) {
+	var s shdefActionGoToPage
+	ok, err := b.sessions.load(token, &s)
+	if err != nil {
+		log.Printf("Failed to load search: %s", err)
+	}
+	if !ok {
+		b.respondExpired(i)
+		return s, false
+	}
+	return s, true
+}
+
+// loadPage loads the search and page that a payload made by pagePayload refers to. Page buttons on messages from
+// before searches were kept in sessions hold the search itself as JSON, page included.
+func (b *Bot) loadPage(i *discordgo.InteractionCreate, rawPayload string) (shdefActionGoToPage, bool) {
+	var s shdefActionGoToPage
+	if strings.HasPrefix(rawPayload, "{") {
+		if err := json.Unmarshal([]byte(rawPayload), &s); err != nil {
+			log.Printf("Failed to unmarshal search: %s", err)
+			return s, false
 		}
+		return s, true
+	}
+
+	token, page, ok := parsePagePayload(rawPayload)
+	if !ok {
+		log.Printf("Malformed payload: %q", rawPayload)
+		return s, false
+	}
+
+	if s, ok = b.loadSearch(i, token); !ok {
+		return s, false
+	}
+	s.Page = page
+	return s, true
+}
+
+// respondExpired tells the user that the session a component refers to has expired.
+func (b *Bot) respondExpired(i *discordgo.InteractionCreate) {
+	if err := b.respond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Color:       0x4B5563,
+					Description: "This search has expired. Run it again to keep browsing!",
+				},
+			},
+		},
+	}); err != nil {
+		log.Printf("Failed to respond: %s", err)
+	}
+}
+
+// updateMessage replaces the message a component is on with data. It answers with the message itself rather than
+// deferring and then editing it, since an edit can reach Discord before a deferral sent over HTTP has.
+func (b *Bot) updateMessage(i *discordgo.InteractionCreate, data *discordgo.InteractionResponseData) {
+	update := *data
+
+	// Empty rather than nil, so that embeds and components not in data are cleared from the message.
+	update.Embeds = append([]*discordgo.MessageEmbed{}, data.Embeds...)
+	update.Components = append([]discordgo.MessageComponent{}, data.Components...)
+
+	if err := b.respond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &update,
+	}); err != nil {
+		log.Printf("Failed to respond: %s", err)
+		return
 	}
 }
 
@@ -176,15 +454,44 @@ type result struct {
 	readings             []string
 	readingsNoDiacritics []string
 	source               string
+
+	// score is how well the result matched, relative to the other results of the same search.
+	score float64
+
+	// variant is the form of the query the result was found by, if it wasn't the query as typed.
+	variant string
+
+	// componentSets are the characters of the word, each followed by its components.
+	componentSets []string
+}
+
+// bestMatchScoreRatio is how many times better than the next result a lookup's first result has to score to be shown on
+// its own. Words and readings that are the query score several times better than those containing it, while results
+// matching the same way score within a small factor of each other.
+const bestMatchScoreRatio = 4
+
+// hasBestMatch reports whether the first of the results of s matches clearly better than the rest, so that it's shown
+// along with them.
+func hasBestMatch(s shdefActionGoToPage, results []result) bool {
+	if len(results) < 2 {
+		return len(results) == 1
+	}
+
+	if s.Mode == searchModeDefault {
+		return results[0].score >= bestMatchScoreRatio*results[1].score
+	}
+
+	// Other modes don't rank results by how well they match, so only a result spelled like the query stands out.
+	return isExactMatch(results[0], s.Query) && !isExactMatch(results[1], s.Query)
 }
 
 func isExactMatch(r result, q string) bool {
-	if q == r.word {
+	if q == r.word || (r.variant != "" && r.variant == r.word) {
 		return true
 	}
 
 	for _, s := range r.simplified {
-		if q == s {
+		if q == s || (r.variant != "" && r.variant == s) {
 			return true
 		}
 	}
@@ -201,10 +508,23 @@ func isExactMatch(r result, q string) bool {
 		}
 	}
 
+	normalized := romanization.Normalize(q)
+	for _, rd := range r.readings {
+		for _, system := range romanization.Converted {
+			if normalized == romanization.Convert(rd, system) {
+				return true
+			}
+		}
+	}
+
 	return false
 }
 
 func fieldToStringList(v interface{}) []string {
+	if v == nil {
+		return nil
+	}
+
 	single, ok := v.(string)
 	if ok {
 		return []string{single}
@@ -220,24 +540,73 @@ func fieldToStringList(v interface{}) []string {
 	return out
 }
 
+// lookupQuery matches any of forms, the query as typed first, preferring matches of the query as typed.
+func lookupQuery(idx *loadedIndex, forms []string) query.Query {
+	var qs []query.Query
+	for i, f := range forms {
+		scale := 1.0
+		if i > 0 {
+			scale = variantBoost
+		}
+
+		if hasWildcards(f) {
+			qs = append(qs, wildcardQuery(f))
+		} else {
+			qs = append(qs, phraseQuery(f, idx.templates, scale))
+		}
+	}
+	return bleve.NewDisjunctionQuery(qs...)
+}
+
+// textMatchQuery matches entries against q, either parsed as an advanced query or as a single phrase in every form of
+// it. It returns the forms for phrases, e.g. 着 also finds 著. Queries with a prefix that isn't a field, e.g.
+// "word:茶 note: tea", are looked up as a phrase, since the prefix may be part of a meaning.
+func textMatchQuery(idx *loadedIndex, q string) (query.Query, []string, error) {
+	if isAdvancedQuery(q) {
+		node, err := parseQuery(q)
+		if err == nil {
+			tq, err := buildQuery(idx, q, node)
+			return tq, nil, err
+		}
+
+		var pe *queryParseError
+		if !errors.As(err, &pe) || !pe.unknownField {
+			return nil, nil, err
+		}
+	}
+
+	forms := queryVariants(q)
+	return lookupQuery(idx, forms), forms, nil
+}
+
 func (b *Bot) lookup(q string, source string, limit int, offset int) ([]result, uint64, error) {
 	q = strings.TrimSpace(q)
 
-	meaningMatch := bleve.NewMatchPhraseQuery(q)
-	meaningMatch.SetField("definitions.meanings")
+	idx, release := b.acquireIndex()
+	defer release()
 
-	readingsMatch := bleve.NewMatchPhraseQuery(q)
-	readingsMatch.SetField("definitions.readings")
+	textMatch, forms, err := textMatchQuery(idx, q)
+	if err != nil {
+		return nil, 0, err
+	}
 
-	readingsNoDiacriticsMatch := bleve.NewMatchPhraseQuery(q)
-	readingsNoDiacriticsMatch.SetField("definitions.readings_no_diacritics")
+	results, count, err := searchIndex(idx, textMatch, source, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
 
-	wordMatch := bleve.NewMatchPhraseQuery(q)
-	wordMatch.SetField("word")
+	if forms != nil && !hasWildcards(q) {
+		for i := range results {
+			results[i].variant = matchedVariant(results[i], forms)
+		}
+	}
 
-	simplifiedMatch := bleve.NewMatchPhraseQuery(q)
-	simplifiedMatch.SetField("simplified")
+	return results, count, nil
+}
 
+// newSearchRequest makes a request for the entries matching textMatch, in source if given. Among equally relevant
+// entries, shorter words come first, then homographs in order, so that results are ordered the same on every page.
+func newSearchRequest(textMatch query.Query, source string, limit int, offset int) *bleve.SearchRequest {
 	var sourceMatch query.Query = bleve.NewMatchAllQuery()
 	if source != "" {
 		realSourceMatch := bleve.NewTermQuery(source)
@@ -245,12 +614,22 @@ func (b *Bot) lookup(q string, source string, limit int, offset int) ([]result,
 		sourceMatch = realSourceMatch
 	}
 
-	req := bleve.NewSearchRequest(bleve.NewConjunctionQuery(bleve.NewDisjunctionQuery(meaningMatch, readingsMatch, readingsNoDiacriticsMatch, wordMatch, simplifiedMatch), sourceMatch))
+	req := bleve.NewSearchRequest(bleve.NewConjunctionQuery(textMatch, sourceMatch))
 	req.Size = limit
 	req.From = offset
-	req.Fields = []string{"word", "simplified", "definitions.readings", "definitions.readings_no_diacritics", "source"}
+	req.Fields = []string{"word", "simplified", "definitions.readings", "definitions.readings_no_diacritics", "source", "component_sets"}
+	req.SortBy([]string{"-_score", "word_length", "homograph", "_id"})
+	return req
+}
+
+// searchIndex finds the entries matching textMatch, in source if given.
+func searchIndex(idx *loadedIndex, textMatch query.Query, source string, limit int, offset int) ([]result, uint64, error) {
+	return searchResults(context.Background(), idx, newSearchRequest(textMatch, source, limit, offset))
+}
 
-	r, err := b.index.Search(req)
+// searchResults runs req, which must ask for the fields of results.
+func searchResults(ctx context.Context, idx *loadedIndex, req *bleve.SearchRequest) ([]result, uint64, error) {
+	r, err := idx.SearchInContext(ctx, req)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -264,6 +643,8 @@ func (b *Bot) lookup(q string, source string, limit int, offset int) ([]result,
 			readings:             fieldToStringList(hit.Fields["definitions.readings"]),
 			readingsNoDiacritics: fieldToStringList(hit.Fields["definitions.readings_no_diacritics"]),
 			source:               hit.Fields["source"].(string),
+			score:                hit.Score,
+			componentSets:        fieldToStringList(hit.Fields["component_sets"]),
 		}
 	}
 
@@ -288,16 +669,20 @@ func truncate(s string, length int, ellipsis string) string {
 	return buf.String() + ellipsis
 }
 
-// query is the entry word
-func makeSearchOutput(query string, source string, count uint64, ids []string, entries map[string]entry, page int, hasNext bool) (*discordgo.WebhookEdit, error) {
+// makeSearchOutput makes the page of results for s, kept in the session with token.
+func (b *Bot) makeSearchOutput(s shdefActionGoToPage, token string, count uint64, results []result, entries map[string]entry, hasNext bool) (*discordgo.WebhookEdit, error) {
+	system, page := s.Romanization, s.Page
+
 	var selectMenuOptions []discordgo.SelectMenuOption
 	// loops through all the entries that include the word
-	for _, id := range ids {
-		entry := entries[id]
+	for _, r := range results {
+		entry := entries[r.id]
 
 		var readings []string
 		for _, definition := range entry.definitions {
-			readings = append(readings, definition.readings...)
+			for _, rd := range definition.readings {
+				readings = append(readings, romanization.Convert(rd, system))
+			}
 		}
 
 		var meanings []string
@@ -305,38 +690,45 @@ func makeSearchOutput(query string, source string, count uint64, ids []string, e
 			meanings = append(meanings, definition.meanings...)
 		}
 
+		description := strings.Join(meanings, "; ")
+		if r.variant != "" {
+			description = fmt.Sprintf("Matched %s: %s", r.variant, description)
+		}
+
+		// Show the Mandarin reading too, for those who know Mandarin better.
+		label := fmt.Sprintf("%s (%s)", entry.displayWord(), strings.Join(readings, ", "))
+		if len(entry.pinyin) > 0 {
+			label = fmt.Sprintf("%s (%s · %s)", entry.displayWord(), strings.Join(readings, ", "), entry.pinyin[0])
+		}
+
 		selectMenuOptions = append(selectMenuOptions, discordgo.SelectMenuOption{
-			Label:       fmt.Sprintf("%s (%s)", entry.word, strings.Join(readings, ", ")),
-			Description: truncate(strings.Join(meanings, "; "), 100, "..."),
-			Value:       id,
+			Label:       truncate(label, 100, "..."),
+			Description: truncate(description, 100, "..."),
+			Value:       r.id,
 		})
 	}
 
+	description := s.describe()
+	if s.Filter != "" {
+		description += " in " + b.dictionaryName(s.Filter)
+	}
+
 	title := new(string)
 	components := new([]discordgo.MessageComponent)
 	if count == 1 {
 		title = new(string)
-		*title = fmt.Sprintf("**1 result for “%s”**", query)
+		*title = fmt.Sprintf("**1 result for %s**", description)
 	} else {
-		*title = fmt.Sprintf("**%d results for “%s”**", count, query)
-
-		prevPagePayload, err := json.Marshal(shdefActionGoToPage{Query: query, Source: source, Page: page - 1})
-		if err != nil {
-			return nil, err
-		}
-
-		nextPagePayload, err := json.Marshal(shdefActionGoToPage{Query: query, Source: source, Page: page + 1})
-		if err != nil {
-			return nil, err
-		}
+		*title = fmt.Sprintf("**%d results for %s**", count, description)
 
 		*components = []discordgo.MessageComponent{
 			discordgo.ActionsRow{
 				Components: []discordgo.MessageComponent{
 					discordgo.SelectMenu{
-						Placeholder: fmt.Sprintf("Select from results %d to %d", page*queryLimit+1, page*queryLimit+len(entries)),
+						Placeholder: fmt.Sprintf("Select from results %d to %d, or several to compare", page*queryLimit+1, page*queryLimit+len(entries)),
 						Options:     selectMenuOptions,
-						CustomID:    customIDPrefixShdefSelect + "|",
+						MaxValues:   min(len(selectMenuOptions), maxMessageEmbeds),
+						CustomID:    customIDPrefixShdefSelect + "|" + string(system) + "|" + pagePayload(token, page),
 					},
 				},
 			},
@@ -347,35 +739,66 @@ func makeSearchOutput(query string, source string, count uint64, ids []string, e
 						Label:    "Previous Page",
 						Style:    discordgo.SecondaryButton,
 						Disabled: page == 0,
-						CustomID: customIDPrefixShdefGoToPage + "|" + string(prevPagePayload),
+						// Custom IDs have to be unique, even on buttons that are disabled.
+						CustomID: customIDPrefixShdefGoToPage + "|" + pagePayload(token, max(page-1, 0)),
 					},
 					discordgo.Button{
 						Emoji:    &discordgo.ComponentEmoji{Name: "▶️"},
 						Label:    "Next Page",
 						Style:    discordgo.SecondaryButton,
 						Disabled: !hasNext,
-						CustomID: customIDPrefixShdefGoToPage + "|" + string(nextPagePayload),
+						CustomID: customIDPrefixShdefGoToPage + "|" + pagePayload(token, page+1),
 					},
 				},
 			},
 		}
 	}
 
-	return &discordgo.WebhookEdit{
+	if s.canNarrow() {
+		counts, err := b.sourceCounts(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(counts) > 1 || s.Filter != "" {
+			if s.Filter == "" {
+				*title += "\n_" + b.describeSourceCounts(counts) + "_"
+			}
+
+			*components = append(*components, b.makeNarrowMenu(s, counts, token))
+		}
+	}
+
+	edit := &discordgo.WebhookEdit{
 		Content:    title,
 		Components: components,
-	}, nil
+	}
+
+	if s.Debug && s.Mode == searchModeDefault {
+		ranking, err := b.makeRankingOutput(s)
+		if err != nil {
+			return nil, err
+		}
+		edit.Embeds = &[]*discordgo.MessageEmbed{ranking}
+	}
+
+	return edit, nil
 }
 
 // handles the output with romanization + characters + definition
-func makeEntryOutput(e entry) *discordgo.MessageEmbed {
+func makeEntryOutput(e entry, d *dictionary, system romanization.System) *discordgo.MessageEmbed {
 	prettyDefs := make([]string, len(e.definitions))
 	for i, def := range e.definitions {
+		readings := make([]string, len(def.readings))
+		for j, rd := range def.readings {
+			readings[j] = romanization.Convert(rd, system)
+		}
+
 		prettyMeaning := "_Meaning unknown_"
 		if len(def.meanings) > 0 {
 			prettyMeaning = strings.Join(def.meanings, "\n")
 		}
-		prettyDefs[i] = fmt.Sprintf("**%s**\n%s", strings.Join(def.readings, ", "), prettyMeaning)
+		prettyDefs[i] = fmt.Sprintf("**%s**\n%s", strings.Join(readings, ", "), prettyMeaning)
 	}
 
 	var prettySimplifieds []string
@@ -401,27 +824,54 @@ func makeEntryOutput(e entry) *discordgo.MessageEmbed {
 		}
 	}
 
-	title := e.word
+	title := e.displayWord()
 	if len(prettySimplifieds) > 0 {
 		title = title + " (" + strings.Join(prettySimplifieds, ", ") + ")"
 	}
 
+	var footerParts []string
+	if d != nil {
+		footerParts = append(footerParts, d.attribution())
+	}
+	if system != romanization.Church {
+		footerParts = append(footerParts, "Readings converted to "+system.Name())
+	}
+
+	var footer *discordgo.MessageEmbedFooter
+	if len(footerParts) > 0 {
+		footer = &discordgo.MessageEmbedFooter{Text: strings.Join(footerParts, "\n")}
+	}
+
 	return &discordgo.MessageEmbed{
 		Title:       title,
 		Color:       0x005BAC,
 		Description: strings.Join(prettyDefs, "\n\n"),
+		Footer:      footer,
 	}
 }
 
-const queryLimit = 25
+func (b *Bot) makeEntryOutput(e entry, system romanization.System) *discordgo.MessageEmbed {
+	d, _ := b.dictionaryBySource(e.source)
+	return makeEntryOutput(e, d, system)
+}
 
-func (b *Bot) HandleShdef(i *discordgo.InteractionCreate, source string) {
-	options := i.ApplicationCommandData().Options
+const queryLimit = 25
 
-	query := strings.TrimSpace(options[0].StringValue())
+func (b *Bot) HandleShdef(i *discordgo.InteractionCreate, source string, mode searchMode) {
+	s := shdefActionGoToPage{Source: source, Romanization: romanization.Church, Mode: mode}
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "query", "components", "pattern":
+			s.Query = strings.TrimSpace(option.StringValue())
+		case "romanization":
+			s.Romanization = parseRomanization(option.StringValue())
+		case "debug":
+			s.Debug = option.BoolValue()
+		}
+	}
 
-	if query == "" {
-		b.discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	if s.Query == "" {
+		b.respond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
 				Embeds: []*discordgo.MessageEmbed{
@@ -435,39 +885,55 @@ func (b *Bot) HandleShdef(i *discordgo.InteractionCreate, source string) {
 		return
 	}
 
-	results, count, err := b.lookup(query, source, queryLimit+1, 0)
-	if err != nil {
-		b.discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	data, err := b.makeShdefResponse(s)
+	var queryErr queryError
+	if errors.As(err, &queryErr) {
+		b.respond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
 				Embeds: []*discordgo.MessageEmbed{
 					{
 						Color:       0xDC2626,
-						Description: "An error occurred.",
+						Title:       queryErr.title(),
+						Description: queryErr.describe(),
 					},
 				},
 			},
 		})
-		log.Printf("Failed to lookup word: %s", err)
 		return
 	}
-
-	if count == 0 {
-		b.discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	if err != nil {
+		b.respond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
-				Content: fmt.Sprintf("**0 results for “%s”**", query),
 				Embeds: []*discordgo.MessageEmbed{
 					{
-						Color:       0x4B5563,
-						Description: "No results found.",
+						Color:       0xDC2626,
+						Description: "An error occurred.",
 					},
 				},
 			},
 		})
+		log.Printf("Failed to lookup word: %s", err)
 		return
 	}
 
+	if err := b.respond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	}); err != nil {
+		log.Printf("Failed to send interaction: %s", err)
+		return
+	}
+}
+
+// makePageOutput searches for s and makes its page of results.
+func (b *Bot) makePageOutput(s shdefActionGoToPage) (*discordgo.WebhookEdit, error) {
+	results, count, err := b.search(s, queryLimit+1, s.Page*queryLimit)
+	if err != nil {
+		return nil, err
+	}
+
 	hasNext := false
 	if len(results) > queryLimit {
 		results = results[:queryLimit]
@@ -481,42 +947,133 @@ func (b *Bot) HandleShdef(i *discordgo.InteractionCreate, source string) {
 
 	entries, err := b.findEntries(resultIDs)
 	if err != nil {
-		log.Printf("Failed to find meanings: %s", err)
-		return
+		return nil, err
 	}
 
-	searchOutput, err := makeSearchOutput(query, source, count, resultIDs, entries, 0, hasNext)
+	token, err := b.saveSearch(s)
 	if err != nil {
-		log.Printf("Failed to make search output: %s", err)
-		return
+		return nil, err
 	}
 
-	var embeds []*discordgo.MessageEmbed
-	if len(results) == 1 || (len(results) > 0 && isExactMatch(results[0], query) && !isExactMatch(results[1], query)) {
-		entries, err := b.findEntries(resultIDs)
+	return b.makeSearchOutput(s, token, count, results, entries, hasNext)
+}
+
+// makeResultsResponse makes the page of results for s as it was first shown, for going back to it.
+func (b *Bot) makeResultsResponse(s shdefActionGoToPage) (*discordgo.InteractionResponseData, error) {
+	if s.Page == 0 {
+		return b.makeShdefResponse(s)
+	}
+
+	searchOutput, err := b.makePageOutput(s)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &discordgo.InteractionResponseData{
+		Content:    *searchOutput.Content,
+		Components: *searchOutput.Components,
+	}
+	if searchOutput.Embeds != nil {
+		data.Embeds = *searchOutput.Embeds
+	}
+	return data, nil
+}
+
+// makeShdefResponse searches for s and makes the first page of results, along with the entry itself if there is a
+// single best match. If nothing matches, it suggests similar words and readings instead.
+func (b *Bot) makeShdefResponse(s shdefActionGoToPage) (*discordgo.InteractionResponseData, error) {
+	query, source, system := s.Query, s.Source, s.Romanization
+	s.Page = 0
+
+	results, count, err := b.search(s, queryLimit+1, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if count == 0 {
+		var suggestions []suggestion
+		if s.Mode == searchModeDefault && !isAdvancedQuery(query) {
+			suggestions, err = b.suggest(query, source)
+			if err != nil {
+				log.Printf("Failed to find suggestions: %s", err)
+			}
+		}
+
+		description := "No results found."
+		if len(suggestions) > 0 {
+			description = "No results found. Did you mean one of these?"
+		}
+
+		components, err := b.makeSuggestionComponents(suggestions, source, system)
 		if err != nil {
-			log.Printf("Failed to get entries: %s", err)
-			return
+			return nil, err
 		}
 
+		return &discordgo.InteractionResponseData{
+			Content: fmt.Sprintf("**0 results for %s**", s.describe()),
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Color:       0x4B5563,
+					Description: description,
+				},
+			},
+			Components: components,
+		}, nil
+	}
+
+	hasNext := false
+	if len(results) > queryLimit {
+		results = results[:queryLimit]
+		hasNext = true
+	}
+
+	resultIDs := make([]string, len(results))
+	for i, r := range results {
+		resultIDs[i] = r.id
+	}
+
+	entries, err := b.findEntries(resultIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := b.saveSearch(s)
+	if err != nil {
+		return nil, err
+	}
+
+	searchOutput, err := b.makeSearchOutput(s, token, count, results, entries, hasNext)
+	if err != nil {
+		return nil, err
+	}
+
+	var embeds []*discordgo.MessageEmbed
+	if hasBestMatch(s, results) {
 		entry, ok := entries[resultIDs[0]]
 		if !ok {
-			log.Printf("Failed to get definitions")
-			return
+			return nil, fmt.Errorf("failed to get entry %s", resultIDs[0])
 		}
 
-		embeds = []*discordgo.MessageEmbed{makeEntryOutput(entry)}
+		embeds = []*discordgo.MessageEmbed{b.makeEntryOutput(entry, system)}
+
+		button, ok, err := b.makeMergedButton(entry, resultIDs[0], token, 0)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			*searchOutput.Components = append(*searchOutput.Components, discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{button},
+			})
+		}
 	}
 
-	if err := b.discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{
-			Embeds:     embeds,
-			Content:    *searchOutput.Content,
-			Components: *searchOutput.Components,
-		},
-	}); err != nil {
-		log.Printf("Failed to send interaction: %s", err)
-		return
+	if searchOutput.Embeds != nil {
+		embeds = append(embeds, *searchOutput.Embeds...)
 	}
+
+	return &discordgo.InteractionResponseData{
+		Embeds:     embeds,
+		Content:    *searchOutput.Content,
+		Components: *searchOutput.Components,
+	}, nil
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// placeholder stands in for any word in a phrase template, e.g. 撥…拉.
+const placeholder = "…"
+
+// Placeholders in words are only written as ….
+var wordPlaceholders = regexp.MustCompile(regexp.QuoteMeta(placeholder))
+
+// Placeholders in readings may also be written as _.
+var readingPlaceholders = regexp.MustCompile(`[…_]`)
+
+// maxTemplates bounds how many phrase templates are loaded from the index.
+const maxTemplates = 10000
+
+// phraseTemplate matches queries that fill in the placeholders of an entry, e.g. 撥書拉 for 撥…拉.
+type phraseTemplate struct {
+	id       string
+	patterns []*regexp.Regexp
+}
+
+// add adds a pattern for template, unless the template already has one for it. Readings often have the same
+// spelling with and without diacritics.
+func (t *phraseTemplate) add(template string, placeholders *regexp.Regexp, seen map[string]bool) {
+	if seen[template] {
+		return
+	}
+	seen[template] = true
+	t.patterns = append(t.patterns, templatePattern(template, placeholders))
+}
+
+func (t *phraseTemplate) matches(q string) bool {
+	for _, p := range t.patterns {
+		if p.MatchString(q) {
+			return true
+		}
+	}
+	return false
+}
+
+// templatePattern turns a template into a regexp matching it with every placeholder filled in.
+func templatePattern(template string, placeholders *regexp.Regexp) *regexp.Regexp {
+	parts := placeholders.Split(template, -1)
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(strings.TrimSpace(p))
+	}
+	return regexp.MustCompile(`^` + strings.Join(parts, `\s*(.+?)\s*`) + `$`)
+}
+
+// loadTemplates loads every entry whose word has placeholders in it.
+func loadTemplates(idx bleve.Index) ([]*phraseTemplate, error) {
+	q := bleve.NewBoolFieldQuery(true)
+	q.SetField("is_template")
+
+	req := bleve.NewSearchRequest(q)
+	req.Size = maxTemplates
+	req.Fields = []string{"word", "simplified", "definitions.readings", "definitions.readings_no_diacritics"}
+
+	r, err := idx.Search(req)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make([]*phraseTemplate, 0, len(r.Hits))
+	for _, hit := range r.Hits {
+		t := &phraseTemplate{id: hit.ID}
+		seen := make(map[string]bool)
+
+		for _, field := range []string{"word", "simplified"} {
+			for _, w := range fieldToStringList(hit.Fields[field]) {
+				if strings.Contains(w, placeholder) {
+					t.add(w, wordPlaceholders, seen)
+				}
+			}
+		}
+
+		for _, field := range []string{"definitions.readings", "definitions.readings_no_diacritics"} {
+			for _, rd := range fieldToStringList(hit.Fields[field]) {
+				if readingPlaceholders.MatchString(rd) {
+					t.add(rd, readingPlaceholders, seen)
+				}
+			}
+		}
+
+		templates = append(templates, t)
+	}
+
+	return templates, nil
+}
+
+// matchTemplates returns the IDs of every template that q fills in.
+func matchTemplates(templates []*phraseTemplate, q string) []string {
+	var ids []string
+	for _, t := range templates {
+		if t.matches(q) {
+			ids = append(ids, t.id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPhraseTemplate(t *testing.T) {
+	tmpl := &phraseTemplate{id: "dict:撥…拉"}
+	seen := make(map[string]bool)
+	tmpl.add("撥…拉", wordPlaceholders, seen)
+	tmpl.add("拨…拉", wordPlaceholders, seen)
+	tmpl.add("peh … la", readingPlaceholders, seen)
+	tmpl.add("peh _ la", readingPlaceholders, seen)
+	tmpl.add("peh … la", readingPlaceholders, seen)
+
+	if len(tmpl.patterns) != 4 {
+		t.Errorf("got %d patterns, want one per distinct spelling, 4", len(tmpl.patterns))
+	}
+
+	tests := []struct {
+		q    string
+		want bool
+	}{
+		{"撥書拉", true},
+		{"拨书拉", true},
+		{"peh sy la", true},
+		{"peh  sy  la", true},
+		{"pehsyla", true},
+		{"撥拉", false},
+		{"撥書拉拉?", false},
+		{"xpeh sy la", false},
+	}
+
+	for _, tt := range tests {
+		if got := tmpl.matches(tt.q); got != tt.want {
+			t.Errorf("matches(%q) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+
+	other := &phraseTemplate{id: "dict:…個"}
+	other.add("…個", wordPlaceholders, make(map[string]bool))
+	if got, want := matchTemplates([]*phraseTemplate{tmpl, other}, "撥個拉"), []string{"dict:撥…拉"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("matchTemplates() = %q, want %q", got, want)
+	}
+}
+
+func TestTemplatePatternQuotes(t *testing.T) {
+	p := templatePattern("a.b…(c)", wordPlaceholders)
+	if !p.MatchString("a.bX(c)") || p.MatchString("aXbX(c)") {
+		t.Errorf("pattern %s doesn't treat the rest of the template literally", p)
+	}
+}
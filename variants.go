@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"strings"
+
+	"github.com/liuzl/gocc"
+)
+
+//go:embed variants.txt
+var variantsTable string
+
+// maxQueryVariants bounds how many forms of a query are searched for, since every variant character multiplies them.
+const maxQueryVariants = 16
+
+var (
+	t2s *gocc.OpenCC
+	s2t *gocc.OpenCC
+
+	// characterVariants maps each variant character to the others in its group.
+	characterVariants map[rune][]rune
+)
+
+// loadVariants loads the OpenCC converters and the table of variant characters.
+func loadVariants() error {
+	var err error
+	if t2s, err = gocc.New("t2s"); err != nil {
+		return err
+	}
+	if s2t, err = gocc.New("s2t"); err != nil {
+		return err
+	}
+
+	characterVariants = make(map[rune][]rune)
+	scanner := bufio.NewScanner(strings.NewReader(variantsTable))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var group []rune
+		for _, f := range strings.Fields(line) {
+			group = append(group, []rune(f)...)
+		}
+
+		for _, r := range group {
+			for _, v := range group {
+				if v != r {
+					characterVariants[r] = append(characterVariants[r], v)
+				}
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// queryVariants returns q along with its traditional and simplified forms, and the forms with variant characters
+// swapped in, e.g. 着 -> 著.
+func queryVariants(q string) []string {
+	forms := []string{q}
+	seen := map[string]bool{q: true}
+	add := func(f string) {
+		if !seen[f] && len(forms) < maxQueryVariants {
+			seen[f] = true
+			forms = append(forms, f)
+		}
+	}
+
+	for _, cc := range []*gocc.OpenCC{t2s, s2t} {
+		if f, err := cc.Convert(q); err == nil {
+			add(f)
+		}
+	}
+
+	for i := 0; i < len(forms); i++ {
+		runes := []rune(forms[i])
+		for j, r := range runes {
+			for _, v := range characterVariants[r] {
+				alt := append([]rune{}, runes...)
+				alt[j] = v
+				add(string(alt))
+			}
+		}
+	}
+
+	return forms
+}
+
+// matchedVariant returns the form of the query that r was found by, or "" if it was found by the query as typed. Forms
+// in the word itself are preferred over forms in its simplified spelling.
+func matchedVariant(r result, forms []string) string {
+	if strings.Contains(r.word, forms[0]) || containsAny(r.simplified, forms[0]) {
+		return ""
+	}
+
+	match := -1
+	for i, f := range forms {
+		if strings.Contains(r.word, f) {
+			match = i
+			break
+		}
+	}
+
+	if match < 0 {
+		for i, f := range forms {
+			if containsAny(r.simplified, f) {
+				match = i
+				break
+			}
+		}
+	}
+
+	if match < 0 {
+		return ""
+	}
+	return forms[match]
+}
+
+func containsAny(ss []string, substr string) bool {
+	for _, s := range ss {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}